@@ -0,0 +1,74 @@
+package cbzopen
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// logRequests logs every request to next once it's answered: what was asked
+// for, the status, how long it took and how many bytes were sent. Bodies
+// are never logged.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			// nothing was written at all, which net/http sends as 200
+			status = http.StatusOK
+		}
+
+		slog.Info("Request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+			"bytes", recorder.bytes,
+			"remote", r.RemoteAddr,
+		)
+	})
+}
+
+// statusRecorder keeps the status and the number of bytes written to the
+// ResponseWriter it wraps.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes on flushes, which /events needs.
+func (w *statusRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,91 @@
+package cbzopen
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogRequests(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int
+	}{
+		{
+			name:       "page",
+			handler:    func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("secret page data")) },
+			wantStatus: http.StatusOK,
+			wantBytes:  16,
+		},
+		{
+			name:       "error",
+			handler:    func(w http.ResponseWriter, r *http.Request) { http.Error(w, "secret page data", http.StatusNotFound) },
+			wantStatus: http.StatusNotFound,
+			wantBytes:  17,
+		},
+		// the first status written is the one sent
+		{
+			name: "written twice",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.WriteHeader(http.StatusOK)
+			},
+			wantStatus: http.StatusTeapot,
+		},
+		{name: "nothing written", handler: func(w http.ResponseWriter, r *http.Request) {}, wantStatus: http.StatusOK},
+		{
+			name: "flushed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(http.Flusher).Flush()
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&out, nil)))
+
+		w := httptest.NewRecorder()
+		logRequests(tt.handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/1.png?x=1", nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("%s: logged %q, want one line", tt.name, lines)
+		}
+		if strings.Contains(lines[0], "secret") {
+			t.Errorf("%s: logged the body: %s", tt.name, lines[0])
+		}
+
+		var entry struct {
+			Msg      string
+			Method   string
+			Path     string
+			Status   int
+			Duration *int64
+			Bytes    int
+			Remote   string
+		}
+		if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if entry.Msg != "Request" || entry.Method != http.MethodGet || entry.Path != "/1.png" || entry.Remote == "" || entry.Duration == nil {
+			t.Errorf("%s: logged %s", tt.name, lines[0])
+		}
+		if entry.Status != tt.wantStatus || entry.Bytes != tt.wantBytes {
+			t.Errorf("%s: logged status %d with %d bytes, want %d with %d", tt.name, entry.Status, entry.Bytes, tt.wantStatus, tt.wantBytes)
+		}
+	}
+}
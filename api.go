@@ -0,0 +1,151 @@
+package cbzopen
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiPage is one entry of the /api/pages response.
+type apiPage struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+}
+
+type apiPages struct {
+	Title string    `json:"title"`
+	Pages []apiPage `json:"pages"`
+}
+
+// basePath returns the path the book is mounted at, e.g. "/books/x.cbz" in a
+// library, by comparing the path the client asked for with what's left
+// after any http.StripPrefix.
+func basePath(r *http.Request) string {
+	requested, _, _ := strings.Cut(r.RequestURI, "?")
+	return strings.TrimSuffix(requested, r.URL.EscapedPath())
+}
+
+// servePages lists the pages in reading order as JSON, for front-ends other
+// than the built-in viewer. The page URLs are absolute paths on this server.
+func (b *book) servePages(w http.ResponseWriter, r *http.Request) {
+	base := basePath(r)
+
+	resp := apiPages{Title: b.info.Title, Pages: make([]apiPage, len(b.imageFiles))}
+	for i, name := range b.imageFiles {
+		resp.Pages[i] = apiPage{Index: i, Name: name, URL: base + "/" + pageURL(name)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to write page list", "err", err)
+	}
+}
+
+// requireJSON answers 415 and returns false unless r says its body is JSON.
+// Browsers only send that Content-Type cross-site after a CORS preflight,
+// which we never allow, so other sites can't post to the API.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	return true
+}
+
+type apiProgress struct {
+	Page int `json:"page"`
+}
+
+// serveProgress takes the page the viewer is on, as {"page": 3}, and hands
+// it to the book's pageViewed callback.
+func (b *book) serveProgress(w http.ResponseWriter, r *http.Request) {
+	if !requireJSON(w, r) {
+		return
+	}
+
+	var progress apiProgress
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&progress); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if progress.Page < 1 || progress.Page > len(b.imageFiles) {
+		http.Error(w, fmt.Sprintf("page must be between 1 and %d", len(b.imageFiles)), http.StatusBadRequest)
+		return
+	}
+
+	if b.pageViewed != nil {
+		b.pageViewed(b.path, progress.Page)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type apiBookmarks struct {
+	Bookmarks []int `json:"bookmarks"`
+}
+
+// serveBookmarks lists the book's bookmarked pages, 1-based and in order.
+func (b *book) serveBookmarks(w http.ResponseWriter, r *http.Request) {
+	pages, err := b.bookmarks.Bookmarks(b.path)
+	if err != nil {
+		slog.Error("Failed to read bookmarks", "file", b.path, "err", err)
+		http.Error(w, "failed to read bookmarks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(apiBookmarks{Bookmarks: pages}); err != nil {
+		slog.Error("Failed to write bookmarks", "err", err)
+	}
+}
+
+// addBookmark bookmarks the page given as {"page": 3}.
+func (b *book) addBookmark(w http.ResponseWriter, r *http.Request) {
+	if !requireJSON(w, r) {
+		return
+	}
+
+	var bookmark apiProgress
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&bookmark); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if bookmark.Page < 1 || bookmark.Page > len(b.imageFiles) {
+		http.Error(w, fmt.Sprintf("page must be between 1 and %d", len(b.imageFiles)), http.StatusBadRequest)
+		return
+	}
+
+	if err := b.bookmarks.AddBookmark(b.path, bookmark.Page); err != nil {
+		slog.Error("Failed to save bookmark", "file", b.path, "err", err)
+		http.Error(w, "failed to save bookmark", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeBookmark handles DELETE /api/bookmarks/{page}.
+func (b *book) removeBookmark(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil {
+		http.Error(w, "invalid page", http.StatusBadRequest)
+		return
+	}
+
+	if err := b.bookmarks.RemoveBookmark(b.path, page); err != nil {
+		slog.Error("Failed to remove bookmark", "file", b.path, "err", err)
+		http.Error(w, "failed to remove bookmark", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
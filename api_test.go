@@ -0,0 +1,156 @@
+package cbzopen
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apiTests are requests to an endpoint taking {"page": n} for a one page
+// book, and what they're answered with.
+var apiTests = []struct {
+	name        string
+	contentType string
+	body        string
+	want        int
+}{
+	{name: "json", contentType: "application/json", body: `{"page": 1}`, want: http.StatusNoContent},
+	{name: "json with charset", contentType: "application/json; charset=utf-8", body: `{"page": 1}`, want: http.StatusNoContent},
+	// what a cross-site form or a fetch without a preflight can send
+	{name: "text", contentType: "text/plain", body: `{"page": 1}`, want: http.StatusUnsupportedMediaType},
+	{name: "form", contentType: "application/x-www-form-urlencoded", body: `{"page": 1}`, want: http.StatusUnsupportedMediaType},
+	{name: "no type", body: `{"page": 1}`, want: http.StatusUnsupportedMediaType},
+	{name: "not json", contentType: "application/json", body: `page=1`, want: http.StatusBadRequest},
+	{name: "no such page", contentType: "application/json", body: `{"page": 2}`, want: http.StatusBadRequest},
+}
+
+// postAPI posts body to path on b as contentType and returns the status.
+func postAPI(b *book, path, contentType, body string) int {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, r)
+
+	return w.Code
+}
+
+func TestServeProgress(t *testing.T) {
+	var viewed []int
+	opts := Options{
+		TempDir:    t.TempDir(),
+		PageViewed: func(path string, page int) { viewed = append(viewed, page) },
+	}
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	b, err := openBook(context.Background(), archivePath, opts.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, tt := range apiTests {
+		viewed = nil
+		if got := postAPI(b, "/api/progress", tt.contentType, tt.body); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+		if recorded := len(viewed) > 0; recorded != (tt.want == http.StatusNoContent) {
+			t.Errorf("%s: pages viewed %v", tt.name, viewed)
+		}
+	}
+}
+
+// memoryBookmarks is a BookmarkStore that keeps them in a map.
+type memoryBookmarks map[string][]int
+
+func (m memoryBookmarks) Bookmarks(path string) ([]int, error) {
+	return m[path], nil
+}
+
+func (m memoryBookmarks) AddBookmark(path string, page int) error {
+	if !slices.Contains(m[path], page) {
+		m[path] = append(m[path], page)
+	}
+	return nil
+}
+
+func (m memoryBookmarks) RemoveBookmark(path string, page int) error {
+	m[path] = slices.DeleteFunc(m[path], func(p int) bool { return p == page })
+	return nil
+}
+
+func TestAddBookmark(t *testing.T) {
+	bookmarks := memoryBookmarks{}
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir(), Bookmarks: bookmarks}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, tt := range apiTests {
+		clear(bookmarks)
+		if got := postAPI(b, "/api/bookmarks", tt.contentType, tt.body); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+		if saved := len(bookmarks[archivePath]) > 0; saved != (tt.want == http.StatusNoContent) {
+			t.Errorf("%s: bookmarks %v", tt.name, bookmarks[archivePath])
+		}
+	}
+}
+
+func TestServePages(t *testing.T) {
+	page := pngData(t, color.White)
+	archivePath := writeZip(t, []testEntry{
+		{name: "10.png", data: page},
+		{name: "2.png", data: page},
+		{name: "a b.png", data: page},
+		{name: "ComicInfo.xml", data: "<ComicInfo><Title>The Book</Title></ComicInfo>"},
+	})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		base    string
+	}{
+		{name: "at the root", handler: b, path: "/api/pages"},
+		// in a library, page URLs include where the book is mounted
+		{name: "in a library", handler: http.StripPrefix("/books/x.cbz", b), path: "/books/x.cbz/api/pages", base: "/books/x.cbz"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, want %d", tt.name, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: Content-Type %q, want application/json", tt.name, got)
+		}
+
+		var got apiPages
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := apiPages{Title: "The Book", Pages: []apiPage{
+			{Index: 0, Name: "2.png", URL: tt.base + "/2.png"},
+			{Index: 1, Name: "10.png", URL: tt.base + "/10.png"},
+			{Index: 2, Name: "a b.png", URL: tt.base + "/a%20b.png"},
+		}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package cbzopen
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+	"golang.org/x/text/encoding"
+)
+
+type archiveFormat int
+
+const (
+	formatUnknown archiveFormat = iota
+	formatZip
+	formatRar
+	formatSevenZip
+	formatTar
+)
+
+func (f archiveFormat) String() string {
+	switch f {
+	case formatZip:
+		return "zip"
+	case formatRar:
+		return "rar"
+	case formatSevenZip:
+		return "7z"
+	case formatTar:
+		return "tar"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	rarMagic      = []byte("Rar!\x1a\x07")
+	sevenZipMagic = []byte("7z\xbc\xaf\x27\x1c")
+	// tarMagic is at tarMagicOffset, in the first entry's header
+	tarMagic       = []byte("ustar")
+	tarMagicOffset = 257
+)
+
+// detectFormat sniffs the archive format from the leading bytes of the file.
+// The extension is deliberately ignored since plenty of .cbz files are
+// actually RAR archives and vice versa.
+func detectFormat(archivePath string) (archiveFormat, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return formatUnknown, err
+	}
+	defer closeWithLog(f, "archive")
+
+	header := make([]byte, tarMagicOffset+len(tarMagic))
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return formatUnknown, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, zipEmptyMagic):
+		return formatZip, nil
+	case bytes.HasPrefix(header, rarMagic):
+		return formatRar, nil
+	case bytes.HasPrefix(header, sevenZipMagic):
+		return formatSevenZip, nil
+	// a gzipped file can only be a .cbt.gz, the others compress themselves
+	case bytes.HasPrefix(header, gzipMagic),
+		len(header) == tarMagicOffset+len(tarMagic) && bytes.Equal(header[tarMagicOffset:], tarMagic):
+		return formatTar, nil
+	default:
+		return formatUnknown, nil
+	}
+}
+
+// isJunk reports whether an archive entry is metadata left behind by the OS
+// that zipped it rather than a page: macOS resource forks under __MACOSX/,
+// AppleDouble "._" files and other dotfiles like .DS_Store, and Windows'
+// Thumbs.db and desktop.ini.
+func isJunk(name string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(name), "/") {
+		if segment == "__MACOSX" {
+			return true
+		}
+	}
+
+	base := path.Base(filepath.ToSlash(name))
+	return strings.HasPrefix(base, ".") ||
+		strings.EqualFold(base, "Thumbs.db") ||
+		strings.EqualFold(base, "desktop.ini")
+}
+
+// safeJoin joins name onto dir and makes sure the result stays within dir,
+// guarding against zip-slip entries like "../../.bashrc".
+func safeJoin(dir, name string) (string, error) {
+	joined := filepath.Join(dir, name)
+	// Rel rather than a prefix check, which gets dirs like "." and "/" wrong
+	rel, err := filepath.Rel(dir, joined)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path in archive: %s", name)
+	}
+
+	return joined, nil
+}
+
+// maxPageSize caps the size of any single extracted file, whatever the
+// overall limit is.
+const maxPageSize = 512 * MiB
+
+// extractOptions controls extractArchiveContext.
+type extractOptions struct {
+	// maxSize caps the total size of the extracted files, so an archive
+	// that decompresses to far more than it claims can't fill the disk.
+	// Zero means no limit.
+	maxSize ByteSize
+	// filenameEncoding decodes zip entry names that aren't UTF-8, which
+	// is common for archives made on non-English Windows
+	filenameEncoding encoding.Encoding
+	// progress, if set, is called after each file is extracted
+	progress func(Progress)
+	// jobs is how many zip entries are extracted at once
+	jobs int
+	// preserveStructure recreates the archive's folders instead of putting
+	// every file at the top level
+	preserveStructure bool
+	// skipErrors logs the files that can't be extracted and goes on with
+	// the rest, instead of failing
+	skipErrors bool
+}
+
+// Progress describes how far along an extraction is.
+type Progress struct {
+	Files int
+	// Total is the number of files that will be extracted, or 0 while it
+	// isn't known yet
+	Total int
+	// Bytes is how much has been written so far
+	Bytes ByteSize
+}
+
+// extraction is the state of a running extractArchiveContext, shared by its
+// workers.
+type extraction struct {
+	ctx      context.Context
+	limit    sizeLimit
+	progress func(Progress)
+	jobs     int
+	total    int
+	preserve bool
+	// skipErrors is extractOptions.skipErrors, skipped the files left out
+	// because of it
+	skipErrors bool
+
+	mu      sync.Mutex
+	files   int
+	skipped []string
+	// seen tracks the flattened names written so far, to warn about
+	// entries that overwrite each other
+	seen map[string]bool
+}
+
+// target returns where the entry name should be extracted to within dir,
+// creating its folder if the structure is kept.
+func (ex *extraction) target(dir, name string) (string, error) {
+	if !ex.preserve {
+		base := path.Base(filepath.ToSlash(name))
+
+		ex.mu.Lock()
+		if ex.seen[base] {
+			slog.Warn("Archive has more than one file with this name, pass -preserve-structure to keep both", "file", base)
+		}
+		ex.seen[base] = true
+		ex.mu.Unlock()
+
+		// flattening can't escape dir, but check anyway for names like ".."
+		return safeJoin(dir, base)
+	}
+
+	extractPath, err := safeJoin(dir, name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(extractPath), 0o755); err != nil {
+		return "", err
+	}
+
+	return extractPath, nil
+}
+
+// skip gives up on the entry name after err when errors are being skipped,
+// logging it and returning nil, and returns err otherwise. Going over the
+// size limit or being cancelled stops the extraction either way.
+func (ex *extraction) skip(name string, err error) error {
+	if !ex.skipErrors || ex.ctx.Err() != nil || errors.Is(err, errArchiveTooLarge) {
+		return err
+	}
+
+	slog.Warn("Skipping file that can't be extracted", "file", name, "err", err)
+	ex.mu.Lock()
+	ex.skipped = append(ex.skipped, name)
+	ex.mu.Unlock()
+
+	return nil
+}
+
+// extracted records that another file has been written.
+func (ex *extraction) extracted() {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	ex.files++
+	if ex.progress != nil {
+		ex.progress(Progress{Files: ex.files, Total: ex.total, Bytes: ex.limit.written()})
+	}
+}
+
+// zipEntryName returns the name of a zip entry as UTF-8. Names the archive
+// doesn't flag as UTF-8 and that aren't valid UTF-8 are decoded from enc,
+// falling back to the raw name if that fails.
+func zipEntryName(file *zip.File, enc encoding.Encoding) string {
+	if enc == nil || file.Flags&0x800 != 0 || utf8.ValidString(file.Name) {
+		return file.Name
+	}
+
+	name, err := enc.NewDecoder().String(file.Name)
+	if err != nil {
+		return file.Name
+	}
+
+	return name
+}
+
+// errArchiveTooLarge is returned once an extraction writes more than its
+// limit.
+var errArchiveTooLarge = errors.New("archive is larger than the limit")
+
+// sizeLimit keeps track of how much an extraction has written so far. It's
+// safe to copy several files through it at once.
+type sizeLimit struct {
+	max ByteSize
+
+	mu   sync.Mutex
+	used ByteSize
+}
+
+// copy copies r to w, failing once the file or the running total gets too
+// large. Sizes declared in archive headers can lie, so this counts the bytes
+// actually written.
+func (l *sizeLimit) copy(w io.Writer, r io.Reader) error {
+	n, err := io.Copy(&limitedWriter{w: w, limit: l}, io.LimitReader(r, int64(maxPageSize)+1))
+	if err != nil {
+		return err
+	}
+
+	if ByteSize(n) > maxPageSize {
+		limit := maxPageSize
+		return fmt.Errorf("file is larger than %v", &limit)
+	}
+
+	return nil
+}
+
+// reserve counts n more bytes against the limit, failing if that would go
+// over it.
+func (l *sizeLimit) reserve(n int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.used+ByteSize(n) > l.max {
+		return fmt.Errorf("%w of %v", errArchiveTooLarge, &l.max)
+	}
+	l.used += ByteSize(n)
+
+	return nil
+}
+
+func (l *sizeLimit) written() ByteSize {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.used
+}
+
+// limitedWriter counts everything written to w against a sizeLimit.
+type limitedWriter struct {
+	w     io.Writer
+	limit *sizeLimit
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if err := lw.limit.reserve(len(p)); err != nil {
+		return 0, err
+	}
+
+	return lw.w.Write(p)
+}
+
+// extractArchiveContext extracts archivePath into dir. It stops as soon as
+// ctx is done, returning ctx.Err().
+func extractArchiveContext(ctx context.Context, archivePath, dir string, opts extractOptions) error {
+	fileInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return fmt.Errorf("archive file does not exist: %w", err)
+	}
+
+	if fileInfo.IsDir() {
+		return errors.New("archive file is a directory")
+	}
+
+	format, err := detectFormat(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	ex := &extraction{
+		ctx:      ctx,
+		limit:    sizeLimit{max: opts.maxSize},
+		progress: opts.progress,
+		jobs:     opts.jobs,
+		preserve: opts.preserveStructure,
+		seen:     map[string]bool{},
+
+		skipErrors: opts.skipErrors,
+	}
+
+	switch format {
+	case formatZip:
+		err = extractZip(archivePath, dir, ex, opts.filenameEncoding)
+	case formatRar:
+		err = extractRar(archivePath, dir, ex)
+	case formatSevenZip:
+		err = extractSevenZip(archivePath, dir, ex)
+	case formatTar:
+		err = extractTar(archivePath, dir, ex)
+	default:
+		err = errors.New("unsupported archive format")
+	}
+
+	if len(ex.skipped) > 0 {
+		slog.Warn("Some files couldn't be extracted and were left out", "file", archivePath, "count", len(ex.skipped), "skipped", ex.skipped)
+	}
+
+	return explainArchiveError(archivePath, err)
+}
+
+// explainArchiveError adds a hint to the errors a truncated or damaged
+// archive usually ends in, which say little on their own.
+func explainArchiveError(archivePath string, err error) error {
+	switch {
+	case errors.Is(err, zip.ErrFormat):
+		return fmt.Errorf("%s is not a valid zip file, it may be truncated or damaged: %w", archivePath, err)
+	case errors.Is(err, tar.ErrHeader):
+		return fmt.Errorf("%s is not a valid tar file, it may be truncated or damaged: %w", archivePath, err)
+	case errors.Is(err, zip.ErrChecksum):
+		return fmt.Errorf("%s is damaged, a file in it doesn't match its checksum: %w", archivePath, err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%s ended unexpectedly, it may be truncated: %w", archivePath, err)
+	default:
+		return err
+	}
+}
+
+// writeFile copies r into a new file at path for ex. A file that fails
+// part way through is removed rather than left half written.
+func (ex *extraction) writeFile(path string, mode os.FileMode, r io.Reader) error {
+	// only the permissions are kept, and something other than a file already
+	// there, like a link left in a folder extracted into with -force, is
+	// never written through
+	if info, err := os.Lstat(path); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is already there and isn't a regular file", path)
+	}
+
+	outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	err = ex.limit.copy(outFile, &contextReader{ctx: ex.ctx, r: r})
+	closeWithLog(outFile, "outFile")
+	if err != nil {
+		removeAllWithLog(path, "partial file")
+		return err
+	}
+
+	return nil
+}
+
+// contextReader fails reads once ctx is done, so a large copy can be
+// interrupted part way through.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
+
+func extractZip(archivePath, dir string, ex *extraction, enc encoding.Encoding) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %w", err)
+	}
+	defer closeWithLog(zipReader, "zipReader")
+
+	var files []*zip.File
+	var names []string
+	for _, file := range zipReader.File {
+		name := zipEntryName(file, enc)
+
+		// directory entries are skipped, target creates folders as needed;
+		// so are links and devices, which a zip can carry in its Unix modes
+		// and which would otherwise be written out as files holding their
+		// target
+		if !file.Mode().IsRegular() || isJunk(name) {
+			continue
+		}
+
+		files = append(files, file)
+		names = append(names, name)
+	}
+	ex.total = len(files)
+
+	// every entry gets its own reader on top of the archive's ReaderAt, so
+	// they can be inflated in parallel
+	return forEach(len(files), ex.jobs, func(i int) error {
+		if err := ex.ctx.Err(); err != nil {
+			return err
+		}
+
+		file := files[i]
+
+		extractPath, err := ex.target(dir, names[i])
+		if err != nil {
+			return ex.skip(names[i], err)
+		}
+
+		fileReader, err := file.Open()
+		if err != nil {
+			return ex.skip(names[i], fmt.Errorf("failed to extract zip file: %w", err))
+		}
+		defer closeWithLog(fileReader, "fileReader")
+
+		if err := ex.writeFile(extractPath, file.Mode(), fileReader); err != nil {
+			return ex.skip(names[i], fmt.Errorf("failed to extract zip file: %w", err))
+		}
+		ex.extracted()
+
+		return nil
+	})
+}
+
+func extractRar(archivePath, dir string, ex *extraction) error {
+	// rar is read as a stream, so count the files from the headers first
+	if ex.progress != nil {
+		headers, err := rardecode.List(archivePath)
+		if err != nil {
+			return fmt.Errorf("failed to read rar file: %w", err)
+		}
+		for _, header := range headers {
+			if header.Mode().IsRegular() && !isJunk(header.Name) {
+				ex.total++
+			}
+		}
+	}
+
+	rarReader, err := rardecode.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open rar file: %w", err)
+	}
+	defer closeWithLog(rarReader, "rarReader")
+
+	for {
+		if err := ex.ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := rarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read rar file: %w", err)
+		}
+
+		// same as zip, folders come from the file paths and links are
+		// skipped
+		if !header.Mode().IsRegular() || isJunk(header.Name) {
+			continue
+		}
+
+		extractPath, err := ex.target(dir, header.Name)
+		if err != nil {
+			if err := ex.skip(header.Name, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := ex.writeFile(extractPath, header.Mode(), rarReader); err != nil {
+			if err := ex.skip(header.Name, fmt.Errorf("failed to extract rar file: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		ex.extracted()
+	}
+
+	return nil
+}
+
+func extractSevenZip(archivePath, dir string, ex *extraction) error {
+	sevenZipReader, err := sevenzip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open 7z file: %w", err)
+	}
+	defer closeWithLog(sevenZipReader, "sevenZipReader")
+
+	var files []*sevenzip.File
+	for _, file := range sevenZipReader.File {
+		if file.Mode().IsRegular() && !isJunk(file.Name) {
+			files = append(files, file)
+		}
+	}
+	ex.total = len(files)
+
+	for _, file := range files {
+		if err := ex.ctx.Err(); err != nil {
+			return err
+		}
+
+		extractPath, err := ex.target(dir, file.Name)
+		if err != nil {
+			if err := ex.skip(file.Name, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = func() error {
+			fileReader, err := file.Open()
+			if err != nil {
+				return err
+			}
+			defer closeWithLog(fileReader, "fileReader")
+
+			return ex.writeFile(extractPath, file.Mode(), fileReader)
+		}()
+
+		if err != nil {
+			if err := ex.skip(file.Name, fmt.Errorf("failed to extract 7z file: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		ex.extracted()
+	}
+
+	return nil
+}
@@ -0,0 +1,658 @@
+package cbzopen
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image/color"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// testEntry is a file to put in a test archive.
+type testEntry struct {
+	name string
+	data string
+	// mode is left as the zip default when zero
+	mode fs.FileMode
+}
+
+// writeZip writes entries as a zip file in a new temporary directory and
+// returns its path.
+func writeZip(t *testing.T, entries []testEntry) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), "book.cbz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeWithLog(f, "test zip")
+
+	zw := zip.NewWriter(f)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func TestSafeJoin(t *testing.T) {
+	tests := []struct {
+		dir, name string
+		want      string
+		wantErr   bool
+	}{
+		{dir: "out", name: "page.jpg", want: filepath.Join("out", "page.jpg")},
+		{dir: "out", name: "ch1/page.jpg", want: filepath.Join("out", "ch1", "page.jpg")},
+		{dir: "out", name: "../evil.txt", wantErr: true},
+		{dir: "out", name: "ch1/../../evil.txt", wantErr: true},
+		{dir: "out", name: "..", wantErr: true},
+		{dir: "out", name: "/etc/passwd", want: filepath.Join("out", "etc", "passwd")},
+		{dir: ".", name: "page.jpg", want: "page.jpg"},
+		{dir: ".", name: "../evil.txt", wantErr: true},
+		{dir: "/", name: "page.jpg", want: filepath.Join("/", "page.jpg")},
+		{dir: "/srv/out", name: "../evil.txt", wantErr: true},
+		{dir: "/srv/out", name: "page.jpg", want: filepath.Join("/srv/out", "page.jpg")},
+	}
+
+	for _, tt := range tests {
+		got, err := safeJoin(tt.dir, tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("safeJoin(%q, %q) = %q, want an error", tt.dir, tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("safeJoin(%q, %q) = %q, %v, want %q", tt.dir, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr bool
+		// want is where the entry ends up, relative to the directory
+		// extracted into
+		want string
+	}{
+		{name: "parent", entry: "../evil.txt", wantErr: true},
+		{name: "nested parent", entry: "ch1/../../evil.txt", wantErr: true},
+		{name: "absolute", entry: "/evil.txt", want: "evil.txt"},
+		{name: "nested", entry: "ch1/page.jpg", want: filepath.Join("ch1", "page.jpg")},
+	}
+
+	for _, tt := range tests {
+		for _, relative := range []bool{false, true} {
+			name := tt.name
+			if relative {
+				name += " into relative dir"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				archivePath := writeZip(t, []testEntry{{name: tt.entry, data: "data"}})
+
+				root := t.TempDir()
+				dir := filepath.Join(root, "out")
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				target := dir
+				if relative {
+					t.Chdir(dir)
+					target = "."
+				}
+
+				err := extractArchiveContext(context.Background(), archivePath, target, extractOptions{preserveStructure: true})
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("extracting succeeded, want an error")
+					}
+					if _, err := os.Stat(filepath.Join(root, "evil.txt")); !os.IsNotExist(err) {
+						t.Errorf("evil.txt was written outside the directory: %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				data, err := os.ReadFile(filepath.Join(dir, tt.want))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != "data" {
+					t.Errorf("extracted %q, want %q", data, "data")
+				}
+			})
+		}
+	}
+}
+
+// writeLyingZip writes a zip holding one page whose header claims it's 10
+// bytes, while it inflates to size bytes, and returns its path.
+func writeLyingZip(t *testing.T, size int) string {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, size)
+	if _, err := fw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "bomb.cbz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeWithLog(f, "test zip")
+
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "1.png",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(compressed.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func TestExtractSizeLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		archivePath string
+		// want is the error, or nil for any
+		want error
+	}{
+		// archive/zip catches the lie itself, as long as nothing's left
+		// behind it can fail either way
+		{name: "zip", archivePath: writeZip(t, []testEntry{{name: "1.png", data: strings.Repeat("x", 64*int(KiB))}}), want: errArchiveTooLarge},
+		{name: "lying zip", archivePath: writeLyingZip(t, 64*int(KiB))},
+		// tar sizes can't lie, but have nothing in front to check them by
+		{name: "tar", archivePath: writeTar(t, []testEntry{{name: "1.png", data: strings.Repeat("x", 64*int(KiB))}}, true), want: errArchiveTooLarge},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		err := extractArchiveContext(context.Background(), tt.archivePath, dir, extractOptions{maxSize: 16 * KiB})
+		if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: extracting: %v, want %v", tt.name, err, tt.want)
+		}
+
+		// the partly written page is removed
+		if _, err := os.Stat(filepath.Join(dir, "1.png")); !os.IsNotExist(err) {
+			t.Errorf("%s: 1.png was left behind: %v", tt.name, err)
+		}
+	}
+}
+
+func TestInMemorySizeLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		archivePath string
+		want        error
+	}{
+		{name: "lying zip", archivePath: writeLyingZip(t, 64*int(KiB))},
+		// tar isn't listed up front, so this is only caught once the page is
+		// reached
+		{name: "tar", archivePath: writeTar(t, []testEntry{{name: "1.png", data: strings.Repeat("x", 64*int(KiB))}}, false), want: errTooBigForMemory},
+	}
+
+	for _, tt := range tests {
+		opts := Options{InMemory: true, MemoryLimit: 16 * KiB, TempDir: t.TempDir()}
+		b := &book{path: tt.archivePath}
+		err := b.openInMemory(context.Background(), opts.book())
+		if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: reading into memory: %v, want %v", tt.name, err, tt.want)
+		}
+		if b.pages != nil {
+			t.Errorf("%s: pages were kept", tt.name)
+		}
+	}
+}
+
+func TestZipSymlinkSkipped(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{
+		{name: "1.png", data: pngData(t, color.White)},
+		{name: "link.png", data: "/etc/passwd", mode: fs.ModeSymlink | 0o777},
+	})
+
+	dir := t.TempDir()
+	if err := extractArchiveContext(context.Background(), archivePath, dir, extractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "link.png")); !os.IsNotExist(err) {
+		t.Errorf("link.png was extracted: %v", err)
+	}
+
+	// served in place, in memory and extracted
+	for _, opts := range []Options{{}, {InMemory: true}, {Extract: true}} {
+		opts.TempDir = t.TempDir()
+		b, err := openBook(context.Background(), archivePath, opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		if !slices.Equal(b.imageFiles, []string{"1.png"}) {
+			t.Errorf("%+v: pages %v, want only 1.png", opts, b.imageFiles)
+		}
+
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/link.png", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%+v: link.png served with status %d, want %d", opts, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+// testdata/book.cbr and book.cb7 each hold 1.png and 2.png, 2x3 pixels and
+// stored uncompressed, along with __MACOSX/._1.png and Thumbs.db.
+func TestExtractRarAndSevenZip(t *testing.T) {
+	for _, name := range []string{"book.cbr", "book.cb7"} {
+		archivePath := filepath.Join("testdata", name)
+
+		dir := t.TempDir()
+		if err := extractArchiveContext(context.Background(), archivePath, dir, extractOptions{preserveStructure: true}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var extracted []string
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				rel, _ := filepath.Rel(dir, path)
+				extracted = append(extracted, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(extracted, []string{"1.png", "2.png"}) {
+			t.Errorf("%s: extracted %v, want the pages without the junk", name, extracted)
+		}
+		if width, height, err := pageSize(os.DirFS(dir), "2.png"); err != nil || width != 2 || height != 3 {
+			t.Errorf("%s: 2.png is %dx%d (%v), want 2x3", name, width, height, err)
+		}
+
+		// the two pages come to well over 100 bytes
+		err = extractArchiveContext(context.Background(), archivePath, t.TempDir(), extractOptions{maxSize: 100})
+		if !errors.Is(err, errArchiveTooLarge) {
+			t.Errorf("%s: extracting over the size limit: %v, want %v", name, err, errArchiveTooLarge)
+		}
+	}
+}
+
+func TestJunkSkipped(t *testing.T) {
+	page := pngData(t, color.White)
+	tests := []struct {
+		name string
+		junk bool
+	}{
+		{"1.png", false},
+		{"ch1/2.png", false},
+		{"__MACOSX/._1.png", true},
+		{"__MACOSX/ch1/2.png", true},
+		{"ch1/._2.png", true},
+		{".DS_Store", true},
+		{"thumbs.db", true},
+		{"ch1/Desktop.ini", true},
+	}
+
+	var entries []testEntry
+	for _, tt := range tests {
+		if got := isJunk(tt.name); got != tt.junk {
+			t.Errorf("isJunk(%q) = %v, want %v", tt.name, got, tt.junk)
+		}
+		entries = append(entries, testEntry{name: tt.name, data: page})
+	}
+
+	dir := t.TempDir()
+	if err := extractArchiveContext(context.Background(), writeZip(t, entries), dir, extractOptions{preserveStructure: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tt.name)))
+		if extracted := err == nil; extracted == tt.junk {
+			t.Errorf("%s extracted = %v, want %v", tt.name, extracted, !tt.junk)
+		}
+	}
+}
+
+func TestShiftJISNames(t *testing.T) {
+	tests := []struct {
+		name string
+		// raw is the name as stored in the zip, without the UTF-8 flag
+		raw  string
+		want string
+	}{
+		{name: "shift-jis", raw: shiftJIS(t, "表紙.png"), want: "表紙.png"},
+		{name: "shift-jis folder", raw: shiftJIS(t, "第1話/01.png"), want: "第1話/01.png"},
+		{name: "ascii", raw: "02.png", want: "02.png"},
+		{name: "utf-8", raw: "あとがき.png", want: "あとがき.png"},
+	}
+
+	var entries []testEntry
+	for _, tt := range tests {
+		entries = append(entries, testEntry{name: tt.raw, data: pngData(t, color.White)})
+	}
+	archivePath := writeZip(t, entries)
+
+	dir := t.TempDir()
+	if err := extractArchiveContext(context.Background(), archivePath, dir, extractOptions{filenameEncoding: japanese.ShiftJIS, preserveStructure: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// served in place too
+	b, err := openBook(context.Background(), archivePath, Options{FilenameEncoding: japanese.ShiftJIS, TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, tt := range tests {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tt.want))); err != nil {
+			t.Errorf("%s: not extracted as %s: %v", tt.name, tt.want, err)
+		}
+		if !slices.Contains(b.imageFiles, tt.want) {
+			t.Errorf("%s: pages %q, want %s among them", tt.name, b.imageFiles, tt.want)
+		}
+	}
+}
+
+// shiftJIS encodes name as Shift-JIS.
+func shiftJIS(t *testing.T, name string) string {
+	t.Helper()
+
+	encoded, err := japanese.ShiftJIS.NewEncoder().String(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encoded
+}
+
+func TestDamagedArchive(t *testing.T) {
+	page := pngData(t, color.White)
+	entries := []testEntry{{name: "1.png", data: page}, {name: "2.png", data: strings.Repeat(page, 100)}}
+
+	// damaged writes data, cut short or with a byte flipped, as a new file
+	damaged := func(archivePath string, cut, flip int) string {
+		t.Helper()
+
+		data, err := os.ReadFile(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cut > 0 {
+			data = data[:cut]
+		}
+		if flip > 0 {
+			data[flip] ^= 0xff
+		}
+		damagedPath := filepath.Join(t.TempDir(), "damaged"+filepath.Ext(archivePath))
+		if err := os.WriteFile(damagedPath, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return damagedPath
+	}
+	zipPath := writeZip(t, entries)
+	tarPath := writeTar(t, entries, true)
+
+	tests := []struct {
+		name        string
+		archivePath string
+		want        string
+	}{
+		{name: "truncated zip", archivePath: damaged(zipPath, 200, 0), want: "may be truncated or damaged"},
+		{name: "truncated tar", archivePath: damaged(tarPath, 200, 0), want: "ended unexpectedly"},
+		{name: "flipped byte in zip", archivePath: damaged(zipPath, 0, 100), want: "damaged"},
+	}
+
+	for _, tt := range tests {
+		err := extractArchiveContext(context.Background(), tt.archivePath, t.TempDir(), extractOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), tt.archivePath) {
+			t.Errorf("%s: extracting: %v, want an error naming the file and saying %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSkipErrors(t *testing.T) {
+	page := pngData(t, color.White)
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: page}, {name: "2.png", data: page}, {name: "3.png", data: page}})
+
+	// flip a byte in the middle of 2.png's data
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := r.File[1].DataOffset()
+	closeWithLog(r, "test zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset+int64(r.File[1].CompressedSize64/2)] ^= 0xff
+	if err := os.WriteFile(archivePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		skipErrors bool
+		maxSize    ByteSize
+		wantErr    bool
+	}{
+		{name: "failing", wantErr: true},
+		{name: "skipping", skipErrors: true},
+		// the size limit isn't an error to skip past
+		{name: "skipping over the limit", skipErrors: true, maxSize: 10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		err := extractArchiveContext(context.Background(), archivePath, dir, extractOptions{skipErrors: tt.skipErrors, maxSize: tt.maxSize})
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s: extracting: %v, want an error: %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			continue
+		}
+
+		extracted, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{filepath.Join(dir, "1.png"), filepath.Join(dir, "3.png")}; !slices.Equal(extracted, want) {
+			t.Errorf("%s: extracted %v, want %v", tt.name, extracted, want)
+		}
+	}
+
+	// read into memory too
+	b, err := openBook(context.Background(), archivePath, Options{InMemory: true, SkipErrors: true, TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if want := []string{"1.png", "3.png"}; !slices.Equal(b.imageFiles, want) {
+		t.Errorf("in memory: pages %v, want %v", b.imageFiles, want)
+	}
+}
+
+func TestExtractTar(t *testing.T) {
+	page := pngData(t, color.White)
+	entries := []testEntry{
+		{name: "1.png", data: page},
+		{name: "ch1/2.png", data: page},
+		{name: "__MACOSX/ch1/._2.png", data: "junk"},
+	}
+
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"tar", false},
+		{"tar.gz", true},
+	}
+
+	for _, tt := range tests {
+		archivePath := writeTar(t, entries, tt.compress)
+		if format, err := detectFormat(archivePath); err != nil || format != formatTar {
+			t.Errorf("%s: detected as %v (%v), want %v", tt.name, format, err, formatTar)
+		}
+
+		dir := t.TempDir()
+		if err := extractArchiveContext(context.Background(), archivePath, dir, extractOptions{preserveStructure: true}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, name := range []string{"1.png", "ch1/2.png"} {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+				t.Errorf("%s: %s not extracted: %v", tt.name, name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "__MACOSX")); !os.IsNotExist(err) {
+			t.Errorf("%s: __MACOSX extracted: %v", tt.name, err)
+		}
+
+		b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"1.png", "2.png"}; !slices.Equal(b.imageFiles, want) {
+			t.Errorf("%s: pages %v, want %v", tt.name, b.imageFiles, want)
+		}
+		b.Close()
+	}
+}
+
+func TestExtractCancelled(t *testing.T) {
+	page := pngData(t, color.White)
+	var entries []testEntry
+	for i := range 10 {
+		entries = append(entries, testEntry{name: fmt.Sprintf("%d.png", i), data: page})
+	}
+	archivePath := writeZip(t, entries)
+
+	// cancelled after the first page is written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	err := extractArchiveContext(ctx, archivePath, dir, extractOptions{jobs: 1, progress: func(Progress) { cancel() }})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("extracting: %v, want %v", err, context.Canceled)
+	}
+	if extracted, _ := os.ReadDir(dir); len(extracted) != 1 {
+		t.Errorf("%d files extracted, want 1", len(extracted))
+	}
+
+	// a copy part way through stops at the next read
+	ctx, cancel = context.WithCancel(context.Background())
+	r := &contextReader{ctx: ctx, r: strings.NewReader(page)}
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("reading after cancelling: %v, want %v", err, context.Canceled)
+	}
+
+	// opening a book leaves nothing behind when it's cancelled
+	tempDir := t.TempDir()
+	if _, err := openBook(ctx, archivePath, Options{Extract: true, TempDir: tempDir}.book()); !errors.Is(err, context.Canceled) {
+		t.Errorf("opening: %v, want %v", err, context.Canceled)
+	}
+	if left, _ := os.ReadDir(tempDir); len(left) > 0 {
+		t.Errorf("%s left behind", left[0].Name())
+	}
+}
+
+func TestPreserveStructure(t *testing.T) {
+	page := pngData(t, color.White)
+	archivePath := writeZip(t, []testEntry{
+		{name: "chapter2/1.png", data: page},
+		{name: "chapter1/10.png", data: page},
+		{name: "chapter1/2.png", data: page},
+		{name: "chapter2/2.png", data: page},
+	})
+	want := []string{"chapter1/2.png", "chapter1/10.png", "chapter2/1.png", "chapter2/2.png"}
+
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{"in place", Options{PreserveStructure: true}},
+		{"in memory", Options{InMemory: true, PreserveStructure: true}},
+		{"extracted", Options{Extract: true, PreserveStructure: true}},
+	}
+
+	for _, mode := range modes {
+		mode.opts.TempDir = t.TempDir()
+		b, err := openBook(context.Background(), archivePath, mode.opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		// pages are in folder order, and each folder's in natural order
+		if !slices.Equal(b.imageFiles, want) {
+			t.Errorf("%s: pages %q, want %q", mode.name, b.imageFiles, want)
+		}
+		for _, name := range want {
+			w := httptest.NewRecorder()
+			b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: %s: status %d, want %d", mode.name, name, w.Code, http.StatusOK)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package cbzopen
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// basicAuth requires HTTP Basic Auth with the given credentials before
+// handing requests to next.
+func basicAuth(next http.Handler, user, pass string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPass, ok := r.BasicAuth()
+
+		// compare both even if the user is wrong, so timing doesn't tell
+		// which one failed
+		userMatch := subtle.ConstantTimeCompare([]byte(gotUser), []byte(user)) == 1
+		passMatch := subtle.ConstantTimeCompare([]byte(gotPass), []byte(pass)) == 1
+
+		if !ok || !userMatch || !passMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cbzopen", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
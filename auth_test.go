@@ -0,0 +1,51 @@
+package cbzopen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := basicAuth(ok, "reader", "secret")
+
+	tests := []struct {
+		name       string
+		user, pass string
+		// noHeader sends no Authorization header at all
+		noHeader bool
+		want     int
+	}{
+		{name: "correct", user: "reader", pass: "secret", want: http.StatusOK},
+		{name: "missing header", noHeader: true, want: http.StatusUnauthorized},
+		{name: "wrong user", user: "someone", pass: "secret", want: http.StatusUnauthorized},
+		{name: "wrong password", user: "reader", pass: "guess", want: http.StatusUnauthorized},
+		{name: "password prefix", user: "reader", pass: "secre", want: http.StatusUnauthorized},
+		{name: "password longer", user: "reader", pass: "secret!", want: http.StatusUnauthorized},
+		{name: "both wrong", user: "someone", pass: "guess", want: http.StatusUnauthorized},
+		{name: "empty", user: "", pass: "", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if !tt.noHeader {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		challenge := w.Header().Get("WWW-Authenticate")
+		if tt.want == http.StatusUnauthorized && challenge == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tt.name)
+		}
+		if tt.want == http.StatusOK && challenge != "" {
+			t.Errorf("%s: WWW-Authenticate %q sent with a successful response", tt.name, challenge)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package cbzopen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrNoPages is returned when opening a book with no images in it.
+var ErrNoPages = errors.New("no images found")
+
+// bookOptions controls how archives are opened and shown.
+type bookOptions struct {
+	// forceExtract sends zip archives through a temp dir instead of serving
+	// them in place
+	forceExtract bool
+	// allowEmpty opens books without any pages instead of failing with
+	// ErrNoPages, showing a "no pages" viewer
+	allowEmpty bool
+	autorotate bool
+	// trim crops near-uniform borders off pages, up to trimThreshold away
+	// from the background color on each channel
+	trim          bool
+	trimThreshold int
+	// tempDir is the parent of the temporary directories, "" for the
+	// system's
+	tempDir string
+	// keep leaves the extracted files behind instead of removing them
+	keep bool
+	// inMemory reads archives into memory rather than a temp dir, as long
+	// as their pages fit in memoryLimit
+	inMemory    bool
+	memoryLimit ByteSize
+	// extensions are the file extensions recognized as pages
+	extensions []string
+	// order sorts page names, see pageOrder
+	order      func(a, b string) int
+	pageViewed func(path string, page int)
+	bookmarks  BookmarkStore
+	// transforms caps how many pages are resized or converted at once,
+	// shared by all the books opened with these options
+	transforms limiter
+	// thumbnailCache keeps thumbnails across runs, see resizer; "" makes
+	// them again for every book opened
+	thumbnailCache string
+	extraction     extractOptions
+	viewer         viewerOptions
+}
+
+// book is an opened archive, ready to be served.
+type book struct {
+	path       string
+	pages      fs.FS
+	imageFiles []string
+	info       comicInfo
+	handler    http.Handler
+	pageViewed func(path string, page int)
+	bookmarks  BookmarkStore
+	resizer    *resizer
+
+	// cleanup undoes everything openBook set up, in reverse order
+	cleanup []func()
+}
+
+// openBook opens the archive or image directory at archivePath. Extracting
+// stops early if ctx is done.
+func openBook(ctx context.Context, archivePath string, opts bookOptions) (*book, error) {
+	b := &book{path: archivePath, pageViewed: opts.pageViewed, bookmarks: opts.bookmarks}
+	if err := b.open(ctx, opts); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *book) open(ctx context.Context, opts bookOptions) error {
+	fileInfo, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+
+	if fileInfo.IsDir() {
+		if opts.autorotate {
+			slog.Warn("-autorotate is not supported for image directories, showing pages as is", "file", b.path)
+		}
+		if opts.trim {
+			slog.Warn("-trim is not supported for image directories, showing pages as is", "file", b.path)
+		}
+
+		err = b.openImageDir(opts)
+	} else {
+		err = b.openArchive(ctx, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.serve(opts)
+}
+
+// serve sets up the handler for the pages found by open.
+func (b *book) serve(opts bookOptions) error {
+	if len(b.imageFiles) == 0 && !opts.allowEmpty {
+		return fmt.Errorf("%w (supported: %s)", ErrNoPages, strings.Join(opts.extensions, ", "))
+	}
+
+	// books kept in memory stay off the disk entirely, so thumbnails are
+	// made again on every request instead of cached
+	var resizeDir, cacheDir string
+	if _, inMemory := b.pages.(*memFS); !inMemory {
+		var err error
+		resizeDir, err = os.MkdirTemp(opts.tempDir, "cbzopen-resized-")
+		if err != nil {
+			return fmt.Errorf("failed to create resized image directory: %w", err)
+		}
+		b.cleanup = append(b.cleanup, func() { removeAllWithLog(resizeDir, "resized image directory") })
+
+		if opts.thumbnailCache != "" {
+			if err := os.MkdirAll(opts.thumbnailCache, 0o755); err != nil {
+				slog.Warn("Not keeping thumbnails", "dir", opts.thumbnailCache, "err", err)
+			} else {
+				cacheDir = opts.thumbnailCache
+			}
+		}
+	}
+
+	known := make(map[string]bool, len(b.imageFiles))
+	for _, name := range b.imageFiles {
+		known[name] = true
+	}
+	b.resizer = &resizer{pages: b.pages, dir: resizeDir, cacheDir: cacheDir, known: known, limit: opts.transforms}
+	pageConverter := &converter{pages: b.pages, dir: resizeDir, limit: opts.transforms}
+	types := &pageTypes{pages: b.pages, known: known}
+
+	var files http.Handler = pageConverter.fallback(types.sniff(serveFiles(b.pages, known)))
+	if opts.viewer.language == "" {
+		index := &localizedIndex{book: b, viewer: opts.viewer}
+		files = index.serve(files)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", cacheHeaders(b.pages, files))
+	mux.Handle("/thumbs/", http.StripPrefix("/thumbs", b.resizer.thumbnails()))
+	mux.Handle("/resize", b.resizer)
+	mux.HandleFunc("GET /api/pages", b.servePages)
+	mux.HandleFunc("POST /api/progress", b.serveProgress)
+	if b.bookmarks != nil {
+		mux.HandleFunc("GET /api/bookmarks", b.serveBookmarks)
+		mux.HandleFunc("POST /api/bookmarks", b.addBookmark)
+		mux.HandleFunc("DELETE /api/bookmarks/{page}", b.removeBookmark)
+	}
+	mux.HandleFunc("GET /download", b.serveDownload)
+	mux.HandleFunc("GET /print", b.servePrint)
+	if opts.viewer.PWA {
+		mux.HandleFunc("GET /manifest.webmanifest", b.serveManifest)
+		mux.HandleFunc("GET /service-worker.js", b.serveServiceWorker)
+	}
+	b.handler = mux
+
+	return nil
+}
+
+// warmThumbnails makes b's thumbnails in the background when they're kept
+// in a cache, where the work isn't lost when b is closed. Closing b stops it
+// first, after trimming the cache to maxThumbnailCache. Only books that are
+// being read are warmed, not every book opened.
+func (b *book) warmThumbnails() {
+	if b.resizer == nil || b.resizer.cacheDir == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		trimThumbnailCache(b.resizer.cacheDir, maxThumbnailCache)
+		b.resizer.warmThumbnails(ctx, b.imageFiles)
+	}()
+	b.cleanup = append(b.cleanup, func() {
+		cancel()
+		<-done
+	})
+}
+
+func (b *book) openArchive(ctx context.Context, opts bookOptions) error {
+	archivePath := b.path
+
+	format, err := detectFormat(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	if opts.inMemory {
+		if opts.autorotate || opts.trim || opts.keep {
+			slog.Warn("-in-memory can't be used with -autorotate, -trim or -keep, extracting to disk", "file", archivePath)
+		} else {
+			err := b.openInMemory(ctx, opts)
+			if !errors.Is(err, errTooBigForMemory) {
+				return err
+			}
+			slog.Info("Archive doesn't fit in memory, extracting to disk", "file", archivePath, "limit", &opts.memoryLimit)
+		}
+	}
+
+	// rotating or trimming pages rewrites them, so that needs a temp dir too,
+	// as does keeping the files
+	if format == formatZip && !opts.forceExtract && !opts.autorotate && !opts.trim && !opts.keep {
+		archiveFS, err := openZipFS(archivePath, opts.extraction.filenameEncoding, opts.extensions, opts.order)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", explainArchiveError(archivePath, err))
+		}
+		b.cleanup = append(b.cleanup, func() { closeWithLog(archiveFS, "archiveFS") })
+
+		b.info = readComicInfo(archiveFS, archivePath)
+		if err := archiveFS.createIndexHTML(b.info, opts.viewer); err != nil {
+			return fmt.Errorf("failed to create index.html: %w", err)
+		}
+
+		b.pages = archiveFS
+		b.imageFiles = archiveFS.imageFiles
+
+		return nil
+	}
+
+	// only zip can be served in place, everything else goes through a temp dir
+	tempDir, err := b.makeTempDir(opts)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Extracting archive", "file", archivePath, "format", format, "dir", tempDir)
+	if err := extractPages(ctx, archivePath, tempDir, opts); err != nil {
+		return err
+	}
+
+	b.info = readComicInfo(os.DirFS(tempDir), archivePath)
+	b.imageFiles, err = createIndexHTML(tempDir, opts.extensions, opts.order, b.info, opts.viewer)
+	if err != nil {
+		return fmt.Errorf("failed to create index.html: %w", err)
+	}
+
+	b.pages = os.DirFS(tempDir)
+
+	return nil
+}
+
+// makeTempDir creates the directory to extract into, removed again when the
+// book is closed unless opts.keep is set.
+func (b *book) makeTempDir(opts bookOptions) (string, error) {
+	tempDir, err := os.MkdirTemp(opts.tempDir, "cbzopen-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	b.cleanup = append(b.cleanup, func() {
+		if opts.keep {
+			slog.Info("Kept extracted files", "file", b.path, "dir", tempDir)
+			return
+		}
+		removeAllWithLog(tempDir, "temporary directory")
+	})
+
+	return tempDir, nil
+}
+
+// extractPages extracts the archive at archivePath into dir, then rotates
+// and trims the pages as opts asks.
+func extractPages(ctx context.Context, archivePath, dir string, opts bookOptions) error {
+	if err := extractArchiveContext(ctx, archivePath, dir, opts.extraction); err != nil {
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	if opts.autorotate {
+		if err := autoRotateDir(dir); err != nil {
+			return fmt.Errorf("failed to rotate pages: %w", err)
+		}
+	}
+
+	if opts.trim {
+		if err := trimDir(dir, opts.trimThreshold); err != nil {
+			return fmt.Errorf("failed to trim pages: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *book) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.handler.ServeHTTP(w, r)
+}
+
+// Close removes everything the book put on disk.
+func (b *book) Close() {
+	for i := len(b.cleanup) - 1; i >= 0; i-- {
+		b.cleanup[i]()
+	}
+	b.cleanup = nil
+}
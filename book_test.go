@@ -0,0 +1,113 @@
+package cbzopen
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNoPages(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "notes.txt", data: "not a page"}})
+
+	// failing says what would have counted as a page
+	_, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+	if !errors.Is(err, ErrNoPages) || !strings.Contains(err.Error(), "supported: ") || !strings.Contains(err.Error(), "png") {
+		t.Errorf("opening: %v, want %v listing the supported extensions", err, ErrNoPages)
+	}
+
+	// or the book opens to a viewer saying there's nothing in it
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir(), AllowEmpty: true}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<p class="empty">No pages found.</p>`) {
+		t.Errorf("empty book: status %d, want %d with the no pages message", w.Code, http.StatusOK)
+	}
+}
+
+func TestLibrarySkipsEmpty(t *testing.T) {
+	dir := writeLibrary(t, "a.cbz")
+	data, err := os.ReadFile(writeZip(t, []testEntry{{name: "notes.txt", data: "not a page"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.cbz"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := openLibrary(dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// the empty archive doesn't stop the library, it's just not there
+	if w := get("/books/empty.cbz/"); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "empty.cbz has no pages") {
+		t.Errorf("empty book: status %d with %q, want %d saying it has no pages", w.Code, w.Body.String(), http.StatusNotFound)
+	}
+	if w := get("/books/a.cbz/"); w.Code != http.StatusOK {
+		t.Errorf("book: status %d, want %d", w.Code, http.StatusOK)
+	}
+	index := get("/").Body.String()
+	if !strings.Contains(index, `href="books/a.cbz/"`) || strings.Contains(index, `href="books/empty.cbz/"`) {
+		t.Errorf("landing page %q, want it to link a.cbz and not empty.cbz", index)
+	}
+}
+
+func TestKeepTempDir(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+
+	tests := []struct {
+		name string
+		opts Options
+		keep bool
+	}{
+		{name: "extracted", opts: Options{Extract: true}},
+		// keeping the files extracts them even without asking
+		{name: "kept", opts: Options{Keep: true}, keep: true},
+	}
+
+	for _, tt := range tests {
+		tempDir := t.TempDir()
+		tt.opts.TempDir = tempDir
+		b, err := openBook(context.Background(), archivePath, tt.opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the pages go in the chosen directory
+		extracted, err := filepath.Glob(filepath.Join(tempDir, "cbzopen-*", "1.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(extracted) != 1 {
+			t.Errorf("%s: pages extracted to %q, want one in %s", tt.name, extracted, tempDir)
+		}
+
+		b.Close()
+		var left []string
+		for _, path := range extracted {
+			if _, err := os.Stat(path); err == nil {
+				left = append(left, path)
+			}
+		}
+		if kept := len(left) > 0; kept != tt.keep {
+			t.Errorf("%s: %q left after closing, want the pages kept: %v", tt.name, left, tt.keep)
+		}
+	}
+}
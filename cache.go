@@ -0,0 +1,37 @@
+package cbzopen
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// pageMaxAge is how long browsers may reuse a page without asking again.
+// Pages don't change while a book is open, but the same URL can serve a
+// different book the next time cbzopen runs on a fixed -port, so this is
+// kept short rather than marking them immutable.
+const pageMaxAge = 3600
+
+// cacheHeaders lets browsers cache the files next serves from pages. Files
+// get a strong ETag from their size and modification time, which
+// http.ServeContent then uses to answer conditional requests with 304.
+// The index page is always revalidated so a regenerated one shows up.
+func cacheHeaders(pages fs.FS, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" || name == "index.html" {
+			w.Header().Set("Cache-Control", "no-cache")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fileInfo, err := fs.Stat(pages, name); err == nil && !fileInfo.IsDir() {
+			w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fileInfo.Size(), fileInfo.ModTime().UnixNano()))
+			w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", pageMaxAge))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
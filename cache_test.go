@@ -0,0 +1,51 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCacheHeaders(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, r)
+		return w
+	}
+
+	first := get("/1.png", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d with ETag %q, want %d with an ETag", first.Code, etag, http.StatusOK)
+	}
+	if got := first.Header().Get("Cache-Control"); !strings.Contains(got, "max-age=") {
+		t.Errorf("Cache-Control %q, want a max-age", got)
+	}
+
+	// asking again with the ETag gets nothing new
+	if second := get("/1.png", etag); second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Errorf("conditional request: status %d with %d bytes, want %d with none", second.Code, second.Body.Len(), http.StatusNotModified)
+	}
+	if other := get("/1.png", `"other"`); other.Code != http.StatusOK {
+		t.Errorf("request with another ETag: status %d, want %d", other.Code, http.StatusOK)
+	}
+
+	// the index is checked every time, so a new one shows up
+	if got := get("/", "").Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("index Cache-Control %q, want no-cache", got)
+	}
+}
@@ -0,0 +1,630 @@
+// Package cbzopen serves comic book archives (cbz, cbr, cb7, cbt) as a web
+// viewer. The cbzopen command in cmd/cbzopen is a thin wrapper around it.
+package cbzopen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+)
+
+//go:embed index.html.tmpl
+var indexHTML embed.FS
+
+// imageExtensions are the pages recognized by default, Options.ImageExtensions
+// adds to them.
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif"}
+
+func closeWithLog(f io.Closer, tag string) {
+	err := f.Close()
+	if err != nil {
+		slog.Warn("Failed to close", "tag", tag, "err", err)
+		return
+	}
+	slog.Debug("Closed", "tag", tag)
+}
+
+func isImage(name string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return slices.Contains(exts, ext)
+}
+
+func removeAllWithLog(path, tag string) {
+	err := os.RemoveAll(path)
+	if err != nil {
+		slog.Warn("Failed to remove", "tag", tag, "path", path, "err", err)
+	}
+}
+
+// imagePages filters names down to image files with one of exts, in reading
+// order.
+func imagePages(names []string, exts []string) []string {
+	var imageFiles []string
+	for _, name := range names {
+		if isImage(name, exts) && !isJunk(name) {
+			imageFiles = append(imageFiles, name)
+		}
+	}
+
+	slices.SortFunc(imageFiles, naturalCompare)
+
+	return imageFiles
+}
+
+// viewerOptions configures the generated viewer page.
+type viewerOptions struct {
+	// RTL lays pages out right-to-left for manga; the default is left-to-right.
+	RTL bool
+	// Spread shows two pages side by side, like an open book.
+	Spread bool
+	// CoverPaired pairs pages from the first one in spread mode, instead of
+	// showing the cover on its own.
+	CoverPaired bool
+	// Scroll stacks all pages in one continuous vertical strip (webtoon
+	// style) instead of showing them one at a time.
+	Scroll bool
+	// Slideshow turns the page every this many seconds; zero leaves it off
+	// until toggled in the viewer.
+	Slideshow int
+	// Loop makes the slideshow start over after the last page.
+	Loop bool
+	// Preload is how many pages on either side of the shown ones are loaded
+	// ahead of time; the rest load as they come into view.
+	Preload int
+	// KeepZoom keeps the zoom level and position when turning the page
+	// instead of going back to the whole page.
+	KeepZoom bool
+	// Watch makes the viewer listen on /events for the book being reloaded,
+	// and refresh when it is.
+	Watch bool
+	// Bookmarks shows the bookmark controls, for when there's a store.
+	Bookmarks bool
+	// PreviousBook and NextBook link to the neighboring books in a library,
+	// relative to the viewer. They're empty at either end and outside of
+	// libraries.
+	PreviousBook string
+	NextBook     string
+	// PWA links a web app manifest and registers a service worker, so the
+	// viewer can be installed and read offline.
+	PWA bool
+	// Static leaves out what needs the server, for a page written out to
+	// sit next to the images: thumbnails show the pages themselves and
+	// there's no "Download all".
+	Static bool
+	// Inline goes with Static and embeds the pages in the page itself as
+	// data: URLs, so the one file is the whole book.
+	Inline bool
+
+	// language is one of Languages to write the viewer in, "" for English
+	// where the reader's browser doesn't ask for another
+	language string
+	// dedupe points repeated pages at their first copy, see dedupePages,
+	// and dedupeConsecutive leaves out those that repeat the page before,
+	// see omitRepeats
+	dedupe            bool
+	dedupeConsecutive bool
+	// template replaces the built-in index.html.tmpl when set
+	template *template.Template
+}
+
+type page struct {
+	Number int
+	Name   string
+	// URL is relative to the viewer, or a data: URL with Inline
+	URL template.URL
+	// Width and Height are 0 if the page's format can't be decoded
+	Width  int
+	Height int
+}
+
+// shortcut is a viewer key binding, as listed in the "?" overlay.
+type shortcut struct {
+	Keys   []string
+	Action string
+}
+
+// shortcuts lists the viewer's keys for opts. It's the one list the help
+// overlay is made from, so keep it in step with the keydown handlers in
+// index.html.tmpl.
+func shortcuts(opts viewerOptions, s uiStrings) []shortcut {
+	list := []shortcut{
+		{[]string{"→", "Page Down", "Space"}, s.NextPage},
+		{[]string{"←", "Page Up", "Shift+Space"}, s.PreviousPage},
+		{[]string{"Home", "End"}, s.FirstLastPage},
+		{[]string{"w", "h"}, s.FitWidthHeight},
+		{[]string{"d"}, s.TwoPages},
+		{[]string{"c"}, s.CoverAlone},
+		{[]string{"s"}, s.PageAloneOrPaired},
+		{[]string{"+", "-"}, s.Zoom},
+		{[]string{"0"}, s.ResetZoom},
+		{[]string{"[", "]"}, s.Rotate},
+		{[]string{"f"}, s.CycleFilters},
+		{[]string{"p"}, s.Slideshow},
+		{[]string{"t"}, s.ToggleThumbnails},
+		{[]string{"i"}, s.ToggleInfo},
+	}
+	if opts.Bookmarks {
+		list = append(list,
+			shortcut{[]string{"b"}, s.ToggleBookmark},
+			shortcut{[]string{"m"}, s.ToggleBookmarks},
+		)
+	}
+	if opts.PreviousBook != "" || opts.NextBook != "" {
+		list = append(list, shortcut{[]string{"{", "}"}, s.PreviousNextBook})
+	}
+
+	return append(list,
+		shortcut{[]string{"?"}, s.ToggleHelp},
+		shortcut{[]string{"Esc"}, s.ClosePanel},
+	)
+}
+
+type indexData struct {
+	viewerOptions
+	Info      comicInfo
+	Pages     []page
+	Shortcuts []shortcut
+	// Lang is the language the viewer is written in and Strings its words
+	Lang    string
+	Strings uiStrings
+}
+
+// pageURL escapes name for use as a relative URL, so characters like "#" or
+// "?" in a filename aren't taken as part of the URL syntax.
+func pageURL(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// pageSize reads the width and height of the image name in pages from its
+// header, without decoding the pixels.
+func pageSize(pages fs.FS, name string) (int, int, error) {
+	f, err := pages.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closeWithLog(f, "page")
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return config.Width, config.Height, nil
+}
+
+// maxImagePixels caps the images decoded, so a small file claiming to be
+// huge can't make us allocate gigabytes. It's well above any scanned page,
+// even a long webtoon strip.
+const maxImagePixels = 128 << 20
+
+// errImageTooLarge is returned by decodeImage for images with more than
+// maxImagePixels pixels.
+var errImageTooLarge = errors.New("image too large to decode")
+
+// decodeImage is image.Decode, but checks the size in the header first and
+// returns errImageTooLarge rather than decoding more than maxImagePixels.
+func decodeImage(r io.Reader) (image.Image, string, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, "", fmt.Errorf("%w: %dx%d", errImageTooLarge, config.Width, config.Height)
+	}
+
+	return image.Decode(io.MultiReader(&header, r))
+}
+
+// builtinTemplate parses index.html.tmpl once, rather than for every book a
+// library opens.
+var builtinTemplate = sync.OnceValues(func() (*template.Template, error) {
+	return template.New("index.html.tmpl").ParseFS(indexHTML, "index.html.tmpl")
+})
+
+// writeIndexHTML writes the viewer for imageFiles, read from pagesFS for
+// their sizes so the layout doesn't jump around as they load.
+func writeIndexHTML(w io.Writer, pagesFS fs.FS, imageFiles []string, info comicInfo, opts viewerOptions) error {
+	tpl := opts.template
+	if tpl == nil {
+		var err error
+		tpl, err = builtinTemplate()
+		if err != nil {
+			return fmt.Errorf("failed to parse HTML template: %w", err)
+		}
+	}
+
+	// reading the headers is most of the work for books with a thousand
+	// pages, so it's spread over the CPUs
+	pages := make([]page, len(imageFiles))
+	var sums []string
+	if opts.dedupe {
+		sums = make([]string, len(imageFiles))
+	}
+	err := forEach(len(imageFiles), runtime.GOMAXPROCS(0), func(i int) error {
+		name := imageFiles[i]
+		pages[i] = page{Number: i + 1, Name: name, URL: template.URL(pageURL(name))}
+		if opts.Inline {
+			url, err := dataURL(pagesFS, name)
+			if err != nil {
+				return err
+			}
+			pages[i].URL = url
+		}
+		if width, height, err := pageSize(pagesFS, name); err == nil {
+			pages[i].Width, pages[i].Height = width, height
+		}
+		if sums != nil {
+			sums[i] = pageSum(pagesFS, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if sums != nil {
+		pages = dedupePages(pages, sums)
+	}
+
+	var unknownSizes []string
+	for _, p := range pages {
+		if p.Width == 0 {
+			unknownSizes = append(unknownSizes, p.Name)
+		}
+	}
+	if len(unknownSizes) > 0 {
+		slog.Warn("Couldn't read the size of some pages, they may shift around as they load", "count", len(unknownSizes), "first", unknownSizes[0])
+	}
+
+	lang := opts.language
+	if lang == "" {
+		lang = Languages[0]
+	}
+	data := indexData{
+		viewerOptions: opts,
+		Info:          info,
+		Pages:         pages,
+		Shortcuts:     shortcuts(opts, translations[lang]),
+		Lang:          lang,
+		Strings:       translations[lang],
+	}
+
+	// the template writes in lots of small pieces
+	buffered := bufio.NewWriter(w)
+	err = tpl.Execute(buffered, data)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return nil
+}
+
+// LoadTemplate reads a viewer template from path to use instead of the
+// built-in one, see Options.Template. It's tried out on a one page book
+// first, so a template that refers to fields that don't exist fails here
+// rather than when a book is opened.
+func LoadTemplate(path string) (*template.Template, error) {
+	tpl, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	sample := indexData{
+		Pages:     []page{{Number: 1, Name: "page1.jpg", URL: "page1.jpg", Width: 800, Height: 1200}},
+		Shortcuts: shortcuts(viewerOptions{}, translations[Languages[0]]),
+		Lang:      Languages[0],
+		Strings:   translations[Languages[0]],
+	}
+	if err := tpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return tpl, nil
+}
+
+// listFiles returns the paths of all files under dir, including those in
+// subfolders, relative to dir and slash separated.
+func listFiles(dir string) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+
+	return names, err
+}
+
+// createIndexHTML writes index.html for the pages in dir, including any in
+// subfolders, and returns the pages in reading order: as listed in info's
+// ComicInfo.xml pages, or by name.
+func createIndexHTML(dir string, exts []string, order func(a, b string) int, info comicInfo, opts viewerOptions) ([]string, error) {
+	names, err := listFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index.html: %w", err)
+	}
+	defer closeWithLog(f, "index.html")
+
+	dirFS := os.DirFS(dir)
+	imageFiles := omitRepeats(dirFS, orderPages(imagePagesFS(dirFS, names, exts, order), info), opts)
+	if err := writeIndexHTML(f, dirFS, imageFiles, info, opts); err != nil {
+		return nil, err
+	}
+
+	return imageFiles, nil
+}
+
+// BookmarkStore keeps the pages readers bookmark, for each book identified
+// by its path. Pages are 1-based.
+type BookmarkStore interface {
+	Bookmarks(path string) ([]int, error)
+	AddBookmark(path string, page int) error
+	RemoveBookmark(path string, page int) error
+}
+
+// DefaultMaxSize is the default for Options.MaxSize.
+const DefaultMaxSize = 4 * GiB
+
+// Options controls how books are opened and shown.
+type Options struct {
+	// Extract sends zip archives through a temp dir instead of serving them
+	// in place.
+	Extract bool
+	// AllowEmpty shows a "no pages" viewer for books without images
+	// instead of failing with ErrNoPages.
+	AllowEmpty bool
+	// Autorotate rotates JPEG pages upright according to their EXIF
+	// orientation.
+	Autorotate bool
+	// Trim crops the near-uniform margins off scanned JPEG and PNG pages.
+	Trim bool
+	// TrimThreshold is how far (0-255 per channel) a pixel may be from the
+	// margin's color and still count as margin.
+	TrimThreshold int
+	// MaxSize caps the total size of extracted files. Zero means no limit.
+	MaxSize ByteSize
+	// FilenameEncoding decodes zip entry names that aren't UTF-8. Nil
+	// leaves them as they are.
+	FilenameEncoding encoding.Encoding
+	// Jobs is how many zip entries are extracted at once.
+	Jobs int
+	// TransformJobs is how many pages may be resized or converted at once;
+	// requests beyond that are answered 429 Too Many Requests. Zero means
+	// no limit.
+	TransformJobs int
+	// PreserveStructure keeps the archive's folders when extracting instead
+	// of putting every file at the top level.
+	PreserveStructure bool
+	// SkipErrors leaves out the files that can't be extracted, with a
+	// warning, instead of failing the whole book.
+	SkipErrors bool
+	// ThumbnailCache is a directory to keep thumbnails in from one run to
+	// the next, named by the hash of each page so they're made again if it
+	// changes. They're made in the background as each book is opened.
+	// Empty means they're made afresh for every book.
+	ThumbnailCache string
+	// Progress, if set, is called after each file is extracted.
+	Progress func(Progress)
+	// TempDir is where the temporary directories go. Empty means the
+	// system's temp directory.
+	TempDir string
+	// Keep leaves the extracted files in place when the book is closed,
+	// logging where they are. It implies Extract.
+	Keep bool
+	// InMemory reads archives into memory instead of extracting them, so
+	// nothing is written to disk. Archives whose pages add up to more than
+	// MemoryLimit are extracted as usual.
+	InMemory bool
+	// MemoryLimit caps how much InMemory may hold per book. Zero means no
+	// limit.
+	MemoryLimit ByteSize
+	// Watch reopens a book when its file changes. It has no effect on
+	// libraries.
+	Watch bool
+	// ImageExtensions are recognized as pages on top of the defaults, e.g.
+	// ".bmp". They must be lowercase with a leading dot.
+	ImageExtensions []string
+	// PageViewed, if set, is called with a book's path and 1-based page
+	// number whenever the viewer reports turning to a page, so the reading
+	// position can be saved.
+	PageViewed func(path string, page int)
+	// Bookmarks, if set, keeps the pages readers bookmark in the viewer.
+	Bookmarks BookmarkStore
+
+	// RTL lays pages out right-to-left for manga.
+	RTL bool
+	// Spread shows two pages side by side.
+	Spread bool
+	// CoverPaired pairs the cover with the next page in spread mode rather
+	// than showing it alone.
+	CoverPaired bool
+	// Scroll shows pages in one continuous vertical strip.
+	Scroll bool
+	// Slideshow turns the page every this many seconds.
+	Slideshow int
+	// Loop makes the slideshow start over after the last page.
+	Loop bool
+	// Preload is how many pages around the shown ones are loaded ahead.
+	Preload int
+	// KeepZoom keeps the zoom level when turning the page.
+	KeepZoom bool
+	// PWA lets the viewer be installed as an app that keeps the open book
+	// for reading offline.
+	PWA bool
+	// Dedupe points pages that are identical to an earlier one at its copy,
+	// so it's only loaded once.
+	Dedupe bool
+	// DedupeConsecutive also leaves out a page that's identical to the one
+	// right before it. It implies Dedupe.
+	DedupeConsecutive bool
+	// Sort is one of SortOrders, how pages are ordered by name when
+	// ComicInfo.xml doesn't say. Empty means SortFullNatural.
+	Sort string
+	// Language is one of Languages to show the viewer in. Empty means the
+	// one the reader's browser prefers, or English.
+	Language string
+	// Template, if set, is used for the viewer page instead of the built-in
+	// one. LoadTemplate reads one from a file.
+	Template *template.Template
+}
+
+func (o Options) extraction() extractOptions {
+	return extractOptions{
+		maxSize:           o.MaxSize,
+		filenameEncoding:  o.FilenameEncoding,
+		progress:          o.Progress,
+		jobs:              o.Jobs,
+		preserveStructure: o.PreserveStructure,
+		skipErrors:        o.SkipErrors,
+	}
+}
+
+func (o Options) book() bookOptions {
+	return bookOptions{
+		forceExtract:   o.Extract,
+		allowEmpty:     o.AllowEmpty,
+		autorotate:     o.Autorotate,
+		trim:           o.Trim,
+		trimThreshold:  o.TrimThreshold,
+		tempDir:        o.TempDir,
+		keep:           o.Keep,
+		inMemory:       o.InMemory,
+		memoryLimit:    o.MemoryLimit,
+		extensions:     slices.Concat(imageExtensions, o.ImageExtensions),
+		order:          pageOrder(o.Sort),
+		pageViewed:     o.PageViewed,
+		bookmarks:      o.Bookmarks,
+		transforms:     newLimiter(o.TransformJobs),
+		thumbnailCache: o.ThumbnailCache,
+		extraction:     o.extraction(),
+		viewer: viewerOptions{
+			RTL:               o.RTL,
+			Spread:            o.Spread,
+			CoverPaired:       o.CoverPaired,
+			Scroll:            o.Scroll,
+			Slideshow:         o.Slideshow,
+			Loop:              o.Loop,
+			Preload:           o.Preload,
+			KeepZoom:          o.KeepZoom,
+			Watch:             o.Watch,
+			Bookmarks:         o.Bookmarks != nil,
+			PWA:               o.PWA,
+			language:          o.Language,
+			dedupe:            o.Dedupe || o.DedupeConsecutive,
+			dedupeConsecutive: o.DedupeConsecutive,
+			template:          o.Template,
+		},
+	}
+}
+
+// Extract extracts the archive at archivePath into dir, creating dir if it
+// doesn't exist. It stops as soon as ctx is done, returning ctx.Err().
+func Extract(ctx context.Context, archivePath, dir string, opts Options) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	return extractArchiveContext(ctx, archivePath, dir, opts.extraction())
+}
+
+// BuildIndex writes the viewer's index.html into dir for the images in it.
+func BuildIndex(dir string, opts Options) error {
+	info := readComicInfo(os.DirFS(dir), dir)
+	bookOpts := opts.book()
+	_, err := createIndexHTML(dir, bookOpts.extensions, bookOpts.order, info, bookOpts.viewer)
+	return err
+}
+
+// WriteIndex writes the viewer page for the archive or image directory at
+// path to w. Pages are linked relative to the page, by the names Extract
+// gives them, so it works saved next to the extracted images.
+func WriteIndex(ctx context.Context, path string, w io.Writer, opts Options) error {
+	return writeStaticIndex(ctx, path, w, opts, false)
+}
+
+// writeStaticIndex is WriteIndex, and Export with inline set.
+func writeStaticIndex(ctx context.Context, path string, w io.Writer, opts Options, inline bool) error {
+	if IsLibrary(path) {
+		return errors.New("can only write the index of a single archive or a directory of images")
+	}
+
+	// extracting rather than serving in place names the pages the way
+	// Extract does; without a server there's no reloading or bookmarking
+	bookOpts := opts.book()
+	bookOpts.forceExtract = true
+	bookOpts.viewer.Watch = false
+	bookOpts.viewer.Bookmarks = false
+	bookOpts.viewer.PWA = false
+	bookOpts.viewer.Static = true
+	bookOpts.viewer.Inline = inline
+
+	b, err := openBook(ctx, path, bookOpts)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if inline {
+		warnLargeExport(b.pages, b.imageFiles)
+	}
+
+	// opening the book wrote the index with these options already
+	index, err := b.pages.Open("index.html")
+	if err != nil {
+		return fmt.Errorf("failed to read index.html: %w", err)
+	}
+	defer closeWithLog(index, "index.html")
+
+	_, err = io.Copy(w, index)
+	return err
+}
+
+// ConvertToPDF writes the pages of the archive or image directory at path
+// to a PDF file at outputPath and returns the number of pages written.
+func ConvertToPDF(ctx context.Context, path, outputPath string, opts Options) (int, error) {
+	if IsLibrary(path) {
+		return 0, errors.New("can only convert a single archive or a directory of images")
+	}
+
+	b, err := openBook(ctx, path, opts.book())
+	if err != nil {
+		return 0, err
+	}
+	defer b.Close()
+
+	return convertToPDF(b, outputPath)
+}
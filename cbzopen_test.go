@@ -0,0 +1,211 @@
+package cbzopen_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cbzopen"
+)
+
+// writeArchive writes a cbz holding a PNG for each of pages and returns its
+// path.
+func writeArchive(t testing.TB, pages ...string) string {
+	t.Helper()
+
+	var page bytes.Buffer
+	if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 2, 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "book.cbz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, name := range pages {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(page.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func TestExtractAndBuildIndex(t *testing.T) {
+	archivePath := writeArchive(t, "page10.png", "page2.png", "page1.png")
+	dir := filepath.Join(t.TempDir(), "book")
+
+	if err := cbzopen.Extract(context.Background(), archivePath, dir, cbzopen.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cbzopen.BuildIndex(dir, cbzopen.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pages are linked in natural order
+	html := string(index)
+	first, second, third := strings.Index(html, `src="page1.png"`), strings.Index(html, `src="page2.png"`), strings.Index(html, `src="page10.png"`)
+	if first < 0 || !(first < second && second < third) {
+		t.Errorf("index.html doesn't link page1.png, page2.png and page10.png in that order")
+	}
+}
+
+func TestServerStartShutdown(t *testing.T) {
+	archivePath := writeArchive(t, "1.png", "2.png")
+
+	s, err := cbzopen.NewServer(context.Background(), archivePath, cbzopen.Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PageCount() != 2 {
+		t.Errorf("PageCount() = %d, want 2", s.PageCount())
+	}
+
+	if err := s.Start("127.0.0.1:0", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + s.Addr().String() + "/api/pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages struct {
+		Pages []struct {
+			Name string `json:"name"`
+		} `json:"pages"`
+	}
+	if err := json.Unmarshal(body, &pages); err != nil {
+		t.Fatalf("decoding %q: %v", body, err)
+	}
+	if len(pages.Pages) != 2 || pages.Pages[0].Name != "1.png" {
+		t.Errorf("/api/pages listed %+v, want 1.png and 2.png", pages.Pages)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + s.Addr().String() + "/api/pages"); err == nil {
+		t.Error("server still answering after Shutdown")
+	}
+}
+
+// manyPages names n pages page1.png to pageN.png.
+func manyPages(n int) []string {
+	pages := make([]string, n)
+	for i := range pages {
+		pages[i] = fmt.Sprintf("page%d.png", i+1)
+	}
+
+	return pages
+}
+
+func BenchmarkExtract(b *testing.B) {
+	archivePath := writeArchive(b, manyPages(1000)...)
+
+	for _, jobs := range []int{1, 4} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for b.Loop() {
+				dir := b.TempDir()
+				if err := cbzopen.Extract(context.Background(), archivePath, dir, cbzopen.Options{Jobs: jobs}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBuildIndex(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("pages=%d", n), func(b *testing.B) {
+			dir := b.TempDir()
+			if err := cbzopen.Extract(context.Background(), writeArchive(b, manyPages(n)...), dir, cbzopen.Options{}); err != nil {
+				b.Fatal(err)
+			}
+
+			for b.Loop() {
+				if err := cbzopen.BuildIndex(dir, cbzopen.Options{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildIndexEscapesNames(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "book")
+	if err := cbzopen.Extract(context.Background(), writeArchive(t, `a&b "c".jpg`), dir, cbzopen.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cbzopen.BuildIndex(dir, cbzopen.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the link is path escaped, then HTML escaped; the name shown as is,
+	// HTML escaped
+	html := string(index)
+	for _, want := range []string{`src="a&amp;b%20%22c%22.jpg"`, `alt="a&amp;b &#34;c&#34;.jpg"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("index.html doesn't contain %s", want)
+		}
+	}
+	if strings.Contains(html, `"c".jpg`) {
+		t.Error(`index.html contains the name unescaped`)
+	}
+}
+
+func TestWriteIndex(t *testing.T) {
+	archivePath := writeArchive(t, "2.png", "1.png")
+
+	var index bytes.Buffer
+	if err := cbzopen.WriteIndex(context.Background(), archivePath, &index, cbzopen.Options{TempDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// pages are linked by the names Extract gives them, and the grid shows
+	// them as they are, with no server to make thumbnails
+	html := index.String()
+	first, second := strings.Index(html, `src="1.png"`), strings.Index(html, `src="2.png"`)
+	if first < 0 || second < first {
+		t.Error("index doesn't link 1.png and 2.png in that order")
+	}
+	if strings.Contains(html, `src="thumbs/`) {
+		t.Error("index links thumbnails, which only a server has")
+	}
+}
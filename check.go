@@ -0,0 +1,172 @@
+package cbzopen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// CheckResult is what Check found in one archive.
+type CheckResult struct {
+	Path string
+	// Format is the archive format going by the file's content, e.g. "zip"
+	Format string
+	Pages  int
+	// Junk are files the OS left behind, like __MACOSX/, which are never
+	// shown
+	Junk []string
+	// Other are files that are neither pages, junk nor ComicInfo.xml
+	Other []string
+	// Unsafe are names that would land outside the folder they're
+	// extracted to, like "../../.bashrc"
+	Unsafe []string
+	// Unreadable are files whose data is damaged
+	Unreadable []string
+	// Err is set if the archive couldn't be read at all
+	Err error
+}
+
+// OK reports whether the archive reads through, has pages and no unsafe
+// names.
+func (c CheckResult) OK() bool {
+	return c.Err == nil && c.Pages > 0 && len(c.Unsafe) == 0 && len(c.Unreadable) == 0
+}
+
+// Check reads through the archive at path, or every archive in the
+// directory at path, without serving or extracting anything. It only fails
+// if there's nothing to check; problems with the archives are in the
+// results.
+func Check(ctx context.Context, path string, opts Options) ([]CheckResult, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archivePaths := []string{path}
+	if fileInfo.IsDir() {
+		files, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+
+		archivePaths = nil
+		for _, file := range files {
+			if !file.IsDir() && isArchive(file.Name()) {
+				archivePaths = append(archivePaths, filepath.Join(path, file.Name()))
+			}
+		}
+		if len(archivePaths) == 0 {
+			return nil, fmt.Errorf("no archives in %s", path)
+		}
+		slices.SortFunc(archivePaths, naturalCompare)
+	}
+
+	bookOpts := opts.book()
+	var results []CheckResult
+	for _, archivePath := range archivePaths {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		results = append(results, checkArchive(ctx, archivePath, bookOpts))
+	}
+
+	return results, nil
+}
+
+func checkArchive(ctx context.Context, archivePath string, opts bookOptions) CheckResult {
+	result := CheckResult{Path: archivePath}
+
+	format, err := detectFormat(archivePath)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if format == formatUnknown {
+		result.Err = errors.New("not a zip, rar, 7z or tar archive")
+		return result
+	}
+	result.Format = format.String()
+
+	err = walkEntries(archivePath, format, opts.extraction.filenameEncoding, func(name string, _ int64, open func() (io.ReadCloser, error)) error {
+		switch {
+		case isJunk(name):
+			result.Junk = append(result.Junk, name)
+			return nil
+		case isUnsafe(name):
+			result.Unsafe = append(result.Unsafe, name)
+			return nil
+		case open == nil:
+			// links and the like, which are never extracted
+			result.Other = append(result.Other, name)
+			return nil
+		}
+
+		header, err := readThrough(ctx, open)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			result.Unreadable = append(result.Unreadable, name)
+		}
+
+		switch {
+		case isImage(name, opts.extensions):
+			result.Pages++
+		case path.Ext(name) == "" && isSniffedImage(header):
+			result.Pages++
+		case !strings.EqualFold(path.Base(name), "ComicInfo.xml"):
+			result.Other = append(result.Other, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		result.Err = explainArchiveError(archivePath, err)
+	}
+
+	return result
+}
+
+// isUnsafe reports whether name would escape the folder it's extracted to,
+// with either kind of slash.
+func isUnsafe(name string) bool {
+	for _, n := range []string{name, strings.ReplaceAll(name, `\`, "/")} {
+		if _, err := safeJoin(string(filepath.Separator)+"x", filepath.FromSlash(n)); err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readThrough reads a file to the end, which is when zip and 7z check its
+// checksum, and returns the start of it for sniffing.
+func readThrough(ctx context.Context, open func() (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeWithLog(r, "entry")
+
+	cr := &contextReader{ctx: ctx, r: io.LimitReader(r, int64(maxPageSize))}
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(cr, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return header[:n], err
+	}
+
+	_, err = io.Copy(io.Discard, cr)
+	return header[:n], err
+}
+
+func isSniffedImage(header []byte) bool {
+	_, ok := sniffHeader(header)
+	return ok
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// parseAuth splits a -auth value of the form user:pass.
+func parseAuth(auth string) (string, string, error) {
+	user, pass, ok := strings.Cut(auth, ":")
+	if !ok || user == "" || pass == "" {
+		return "", "", errors.New("auth must be in the form user:pass")
+	}
+
+	return user, pass, nil
+}
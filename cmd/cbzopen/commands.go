@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// subcommands are the words cbzopen takes before the file, each naming the
+// flag its -o stands for: "extract" is -extract-to and "convert" is -to-pdf.
+// "serve" is what cbzopen does without one.
+var subcommands = map[string]string{
+	"serve":   "",
+	"extract": "extract-to",
+	"convert": "to-pdf",
+}
+
+// usage is flag.Usage, listing the subcommands before the flags.
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprint(out, `Usage:
+  cbzopen [serve] [flags] file...
+  cbzopen extract file -o dir [flags]
+  cbzopen convert file -o book.pdf [flags]
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// parseCommandLine parses args into flags and returns the subcommand, ""
+// without one, and the arguments left over. After a subcommand, flags may
+// come after the file too, as in "cbzopen extract book.cbz -o book".
+func parseCommandLine(flags *flag.FlagSet, args []string) (string, []string, error) {
+	command := ""
+	if len(args) > 0 {
+		if _, ok := subcommands[args[0]]; ok {
+			command = args[0]
+			args = args[1:]
+		}
+	}
+	if command == "" {
+		err := flags.Parse(args)
+		return "", flags.Args(), err
+	}
+
+	args = renameOutputFlag(args, subcommands[command])
+
+	var rest []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return command, nil, err
+		}
+
+		left := flags.Args()
+		if len(left) == 0 {
+			return command, rest, nil
+		}
+
+		// everything after "--" is a file, even if it starts with "-"
+		if parsed := len(args) - len(left); parsed > 0 && args[parsed-1] == "--" {
+			return command, append(rest, left...), nil
+		}
+
+		rest = append(rest, left[0])
+		args = left[1:]
+	}
+}
+
+// renameOutputFlag turns -o in args into -name, the flag it stands for, up
+// to "--". Without a name, -o is left alone so it's reported as unknown.
+func renameOutputFlag(args []string, name string) []string {
+	if name == "" {
+		return args
+	}
+
+	renamed := make([]string, len(args))
+	copy(renamed, args)
+	for i, arg := range renamed {
+		if arg == "--" {
+			break
+		}
+
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || flagName != "o" {
+			continue
+		}
+
+		renamed[i] = "-" + name
+		if hasValue {
+			renamed[i] += "=" + value
+		}
+	}
+
+	return renamed
+}
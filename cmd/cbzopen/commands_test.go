@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		args        []string
+		wantCommand string
+		wantArgs    []string
+		wantOutput  string
+		wantPort    int
+		wantErr     bool
+	}{
+		// without a subcommand, flags stop at the first file as they always have
+		{args: []string{"-port", "80", "a.cbz", "-port", "90"}, wantArgs: []string{"a.cbz", "-port", "90"}, wantPort: 80},
+		{args: []string{"serve", "a.cbz", "-port", "80"}, wantCommand: "serve", wantArgs: []string{"a.cbz"}, wantPort: 80},
+		{args: []string{"extract", "a.cbz", "-o", "pages"}, wantCommand: "extract", wantArgs: []string{"a.cbz"}, wantOutput: "pages"},
+		{args: []string{"extract", "--o=pages", "a.cbz"}, wantCommand: "extract", wantArgs: []string{"a.cbz"}, wantOutput: "pages"},
+		{args: []string{"convert", "a.cbz", "-o", "a.pdf"}, wantCommand: "convert", wantArgs: []string{"a.cbz"}, wantOutput: "a.pdf"},
+		// a file named like a subcommand can still be opened
+		{args: []string{"./serve"}, wantArgs: []string{"./serve"}},
+		{args: []string{"extract", "-o", "pages", "--", "-o"}, wantCommand: "extract", wantArgs: []string{"-o"}, wantOutput: "pages"},
+		{args: []string{"serve", "-o", "pages", "a.cbz"}, wantCommand: "serve", wantErr: true},
+		{args: []string{"-o", "pages", "a.cbz"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("cbzopen", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		port := flags.Int("port", 0, "")
+		extractTo := flags.String("extract-to", "", "")
+		toPDF := flags.String("to-pdf", "", "")
+
+		command, args, err := parseCommandLine(flags, tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, want error %t", tt.args, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		output := *extractTo + *toPDF
+		if command != tt.wantCommand || !slices.Equal(args, tt.wantArgs) || output != tt.wantOutput || *port != tt.wantPort {
+			t.Errorf("%q: %q %q with -o %q and -port %d, want %q %q with -o %q and -port %d",
+				tt.args, command, args, output, *port, tt.wantCommand, tt.wantArgs, tt.wantOutput, tt.wantPort)
+		}
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	page := pageData(t)
+	book := writeZip(t, map[string]string{"1.png": page, "2.png": page})
+
+	dir := filepath.Join(t.TempDir(), "pages")
+	if _, code := runMain(t, "extract", book, "-o", dir); code != 0 {
+		t.Fatalf("extract exited %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2.png")); err != nil {
+		t.Errorf("extract didn't write the pages: %v", err)
+	}
+
+	pdf := filepath.Join(t.TempDir(), "book.pdf")
+	if _, code := runMain(t, "convert", book, "-o", pdf); code != 0 {
+		t.Fatalf("convert exited %d", code)
+	}
+	data, err := os.ReadFile(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "%PDF-") {
+		t.Errorf("convert wrote %.10q, want a PDF", data)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config holds defaults for the command line flags, read from a TOML file.
+// Every field is a pointer so unset keys can be told apart from zero values,
+// and each toml key must match the name of its flag.
+type config struct {
+	Host       *string `toml:"host"`
+	Interface  *string `toml:"interface"`
+	Port       *int    `toml:"port"`
+	PortRange  *int    `toml:"port-range"`
+	UnixSocket *string `toml:"unix-socket"`
+	Open       *bool   `toml:"open"`
+	PrintURL   *bool   `toml:"print-url"`
+	Extract    *bool   `toml:"extract"`
+	TmpDir     *string `toml:"tmp-dir"`
+	ThumbCache *string `toml:"thumb-cache"`
+	Keep       *bool   `toml:"keep"`
+	InMemory   *bool   `toml:"in-memory"`
+	Watch      *bool   `toml:"watch"`
+	MaxSize    *string `toml:"max-size"`
+	// MemoryLimit is a size string like "512M"
+	MemoryLimit *string `toml:"memory-limit"`
+	// FilenameEncoding is the encoding of non-UTF-8 zip entry names
+	FilenameEncoding  *string `toml:"filename-encoding"`
+	Jobs              *int    `toml:"jobs"`
+	TransformJobs     *int    `toml:"transform-jobs"`
+	PreserveStructure *bool   `toml:"preserve-structure"`
+	SkipErrors        *bool   `toml:"skip-errors"`
+	LogLevel          *string `toml:"log-level"`
+	LogFormat         *string `toml:"log-format"`
+	RTL               *bool   `toml:"rtl"`
+	Spread            *bool   `toml:"spread"`
+	CoverSingle       *bool   `toml:"cover-single"`
+	Scroll            *bool   `toml:"scroll"`
+	Slideshow         *int    `toml:"slideshow"`
+	Loop              *bool   `toml:"loop"`
+	Preload           *int    `toml:"preload"`
+	KeepZoom          *bool   `toml:"keep-zoom"`
+	Template          *string `toml:"template"`
+	PWA               *bool   `toml:"pwa"`
+	Lang              *string `toml:"lang"`
+	Sort              *string `toml:"sort"`
+	Dedupe            *bool   `toml:"dedupe"`
+	DedupeConsecutive *bool   `toml:"dedupe-consecutive"`
+	Ext               *string `toml:"ext"`
+	Autorotate        *bool   `toml:"autorotate"`
+	Trim              *bool   `toml:"trim"`
+	TrimThreshold     *int    `toml:"trim-threshold"`
+	TLSCert           *string `toml:"tls-cert"`
+	TLSKey            *string `toml:"tls-key"`
+	Auth              *string `toml:"auth"`
+	AccessLog         *bool   `toml:"access-log"`
+	Browser           *string `toml:"browser"`
+	// ShutdownTimeout is a duration string like "5s"
+	ShutdownTimeout *string `toml:"shutdown-timeout"`
+}
+
+// findConfig returns the config file to use: the explicitly given path if
+// any, otherwise cbzopen/config.toml in the user config dir if it exists.
+// An empty path means there is no config file.
+func findConfig(explicit string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// no config dir (e.g. $HOME unset), so no config either
+		return "", nil
+	}
+
+	path := filepath.Join(configDir, "cbzopen", "config.toml")
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return path, nil
+}
+
+func loadConfig(path string) (config, error) {
+	var cfg config
+
+	meta, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return cfg, fmt.Errorf("unknown key %q in config file", undecoded[0].String())
+	}
+
+	return cfg, nil
+}
+
+// applyConfig fills in the flags that weren't given on the command line from
+// cfg, so command line flags always win over the config file.
+func applyConfig(flags *flag.FlagSet, cfg config) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	value := reflect.ValueOf(cfg)
+	for i := range value.NumField() {
+		name := value.Type().Field(i).Tag.Get("toml")
+		field := value.Field(i)
+		if field.IsNil() || set[name] {
+			continue
+		}
+
+		if err := flags.Set(name, fmt.Sprint(field.Elem().Interface())); err != nil {
+			return fmt.Errorf("invalid %s in config file: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// envName returns the environment variable for a flag, e.g. CBZOPEN_PORT for
+// -port and CBZOPEN_MAX_SIZE for -max-size.
+func envName(flagName string) string {
+	return "CBZOPEN_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv fills in the flags that weren't given on the command line from
+// CBZOPEN_* environment variables looked up with getenv. It runs before
+// applyConfig, so the order of precedence is flags, then the environment,
+// then the config file.
+func applyEnv(flags *flag.FlagSet, getenv func(string) (string, bool)) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		// the file comes from the command line, a default would hide the
+		// positional argument
+		if err != nil || set[f.Name] || f.Name == "file" {
+			return
+		}
+
+		name := envName(f.Name)
+		value, ok := getenv(name)
+		if !ok {
+			return
+		}
+
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", name, setErr)
+		}
+	})
+
+	return err
+}
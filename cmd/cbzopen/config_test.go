@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file holding contents and returns its path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	flags := flag.NewFlagSet("cbzopen", flag.ContinueOnError)
+	host := flags.String("host", "localhost", "")
+	iface := flags.String("interface", "", "")
+	port := flags.Int("port", 0, "")
+	rtl := flags.Bool("rtl", false, "")
+	maxSize := flags.String("max-size", "4G", "")
+
+	// host is given on the command line, port in the environment as well as
+	// the config file, and rtl only in the config file
+	if err := flags.Parse([]string{"-host", "0.0.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"CBZOPEN_PORT": "8080", "CBZOPEN_HOST": "192.0.2.1"}
+	getenv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := applyEnv(flags, getenv); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(writeConfig(t, `
+host = "192.0.2.2"
+interface = "eth0"
+port = 9090
+rtl = true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(flags, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if *host != "0.0.0.0" {
+		t.Errorf("host = %q, want the flag's 0.0.0.0", *host)
+	}
+	if *port != 8080 {
+		t.Errorf("port = %d, want the environment's 8080", *port)
+	}
+	if !*rtl {
+		t.Error("rtl = false, want the config file's true")
+	}
+	if *iface != "eth0" {
+		t.Errorf("interface = %q, want the config file's eth0", *iface)
+	}
+	if *maxSize != "4G" {
+		t.Errorf("max-size = %q, want the default 4G", *maxSize)
+	}
+}
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	_, err := loadConfig(writeConfig(t, `colour = "red"`))
+	if err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("loading an unknown key: %v, want an error naming it", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		value   string
+		flag    string
+		want    string
+		wantErr bool
+	}{
+		{env: "CBZOPEN_PORT", value: "8080", flag: "port", want: "8080"},
+		{env: "CBZOPEN_HOST", value: "0.0.0.0", flag: "host", want: "0.0.0.0"},
+		{env: "CBZOPEN_OPEN", value: "false", flag: "open", want: "false"},
+		{env: "CBZOPEN_MAX_SIZE", value: "1G", flag: "max-size", want: "1G"},
+		{env: "CBZOPEN_PORT", value: "eighty", flag: "port", wantErr: true},
+		// the book to open only comes from the command line
+		{env: "CBZOPEN_FILE", value: "book.cbz", flag: "file", want: ""},
+	}
+
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("cbzopen", flag.ContinueOnError)
+		flags.Int("port", 0, "")
+		flags.String("host", "localhost", "")
+		flags.Bool("open", true, "")
+		flags.String("max-size", "4G", "")
+		flags.String("file", "", "")
+
+		getenv := func(name string) (string, bool) {
+			if name == tt.env {
+				return tt.value, true
+			}
+			return "", false
+		}
+		err := applyEnv(flags, getenv)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s=%s: %v, want an error: %v", tt.env, tt.value, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.env) {
+				t.Errorf("%s=%s: error %q doesn't name the variable", tt.env, tt.value, err)
+			}
+			continue
+		}
+		if got := flags.Lookup(tt.flag).Value.String(); got != tt.want {
+			t.Errorf("%s=%s: -%s = %q, want %q", tt.env, tt.value, tt.flag, got, tt.want)
+		}
+	}
+}
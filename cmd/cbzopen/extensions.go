@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var extensionPattern = regexp.MustCompile(`^\.[a-z0-9]+$`)
+
+// parseExtensions splits a comma-separated -ext value like "bmp,.TIFF" into
+// lowercase extensions with a leading dot.
+func parseExtensions(list string) ([]string, error) {
+	var exts []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		if !extensionPattern.MatchString(ext) {
+			return nil, fmt.Errorf("%q doesn't look like a file extension", ext)
+		}
+		exts = append(exts, ext)
+	}
+
+	return exts, nil
+}
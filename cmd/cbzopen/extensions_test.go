@@ -0,0 +1,33 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseExtensions(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{list: "bmp", want: []string{".bmp"}},
+		{list: "bmp, .TIFF,jxl", want: []string{".bmp", ".tiff", ".jxl"}},
+		{list: "bmp,,", want: []string{".bmp"}},
+		{list: "tar.gz", wantErr: true},
+		{list: "../png", wantErr: true},
+		{list: "b m p", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseExtensions(tt.list)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("parseExtensions(%q): %v, want an error: %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseExtensions(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
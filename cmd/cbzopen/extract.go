@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"cbzopen"
+)
+
+// prepareExtractDir creates dir for -extract-to if needed. Unless force is
+// set, it refuses to write into a directory that already has something in
+// it.
+func prepareExtractDir(dir string, force bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	if force {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s is not empty, pass -force to extract into it anyway", dir)
+	}
+
+	return nil
+}
+
+// spoolStdin copies an archive piped in on r to a temp file in tempDir
+// ("" for the system's), since the archive readers need to seek, and returns
+// its path. The caller removes the directory it's in when done.
+func spoolStdin(r io.Reader, maxSize cbzopen.ByteSize, tempDir string) (string, error) {
+	dir, err := os.MkdirTemp(tempDir, "cbzopen-stdin-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	// the name only shows up as the fallback title
+	archivePath := filepath.Join(dir, "stdin.cbz")
+	if maxSize > 0 {
+		r = io.LimitReader(r, int64(maxSize)+1)
+	}
+
+	outFile, err := os.Create(archivePath)
+	if err != nil {
+		removeAllWithLog(dir, "stdin directory")
+		return "", err
+	}
+	defer closeWithLog(outFile, "stdin archive")
+
+	n, err := io.Copy(outFile, r)
+	if err == nil && maxSize > 0 && cbzopen.ByteSize(n) > maxSize {
+		err = fmt.Errorf("archive is larger than the limit of %v", &maxSize)
+	}
+	if err != nil {
+		removeAllWithLog(dir, "stdin directory")
+		return "", fmt.Errorf("failed to read archive from stdin: %w", err)
+	}
+
+	return archivePath, nil
+}
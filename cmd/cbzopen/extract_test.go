@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cbzopen"
+)
+
+func TestExtractTo(t *testing.T) {
+	page := pageData(t)
+	book := writeZip(t, map[string]string{"1.png": page, "2.png": page})
+
+	// missing directories are created
+	dir := filepath.Join(t.TempDir(), "pages")
+	if _, code := runMain(t, "-extract-to", dir, book); code != 0 {
+		t.Fatalf("-extract-to exited %d", code)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"1.png", "2.png"}; !slices.Equal(names, want) {
+		t.Errorf("extracted %q, want %q", names, want)
+	}
+
+	// what's there already is only written over with -force
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := runMain(t, "-extract-to", dir, book); code == 0 {
+		t.Error("-extract-to into a directory that isn't empty succeeded")
+	}
+	if _, code := runMain(t, "-extract-to", dir, "-force", book); code != 0 {
+		t.Errorf("-extract-to with -force exited %d", code)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("-force removed what was there: %v", err)
+	}
+}
+
+func TestSpoolStdin(t *testing.T) {
+	archive := strings.Repeat("cbz", 100)
+
+	tests := []struct {
+		name    string
+		maxSize cbzopen.ByteSize
+		wantErr bool
+	}{
+		{name: "no limit"},
+		{name: "under the limit", maxSize: 300},
+		{name: "over the limit", maxSize: 299, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tempDir := t.TempDir()
+		path, err := spoolStdin(strings.NewReader(archive), tt.maxSize, tempDir)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s: spoolStdin: %v, want an error: %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			// nothing is left behind when it fails
+			if entries, _ := os.ReadDir(tempDir); len(entries) > 0 {
+				t.Errorf("%s: %s left behind", tt.name, entries[0].Name())
+			}
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != archive {
+			t.Errorf("%s: spooled %d bytes, want %d", tt.name, len(data), len(archive))
+		}
+	}
+}
+
+func TestStdin(t *testing.T) {
+	page := pageData(t)
+	archive, err := os.ReadFile(writeZip(t, map[string]string{"1.png": page, "2.png": page}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "pages")
+	cmd := mainCommand(t, "-tmp-dir", tempDir, "-extract-to", dir, "-")
+	cmd.Stdin = bytes.NewReader(archive)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"1.png", "2.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	// the copy of stdin is gone once it's been read
+	if entries, _ := os.ReadDir(tempDir); len(entries) > 0 {
+		t.Errorf("%s left behind", entries[0].Name())
+	}
+}
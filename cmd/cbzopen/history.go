@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// maxHistory is how many recently opened books are remembered.
+const maxHistory = 20
+
+type historyEntry struct {
+	Path   string    `json:"path"`
+	Opened time.Time `json:"opened"`
+}
+
+func historyFile() (string, error) {
+	return stateFile("history.json")
+}
+
+// readHistory returns the entries in path, most recent first. A missing file
+// is an empty history.
+func readHistory(path string) ([]historyEntry, error) {
+	var history []historyEntry
+	err := readState(path, &history)
+	return history, err
+}
+
+// recordHistory moves bookPath to the top of the history in path, dropping
+// any earlier entry for it and the oldest ones past maxHistory.
+func recordHistory(path, bookPath string, opened time.Time) error {
+	history, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+
+	history = slices.DeleteFunc(history, func(entry historyEntry) bool {
+		return entry.Path == bookPath
+	})
+	history = slices.Insert(history, 0, historyEntry{Path: bookPath, Opened: opened})
+	history = history[:min(len(history), maxHistory)]
+
+	return writeState(path, history)
+}
+
+// addToHistory records bookPath in the history file as opened just now.
+func addToHistory(bookPath string) error {
+	absPath, err := filepath.Abs(bookPath)
+	if err != nil {
+		return err
+	}
+
+	path, err := historyFile()
+	if err != nil {
+		return err
+	}
+
+	return recordHistory(path, absPath, time.Now())
+}
+
+func printHistory(w io.Writer, history []historyEntry) {
+	for _, entry := range history {
+		fmt.Fprintf(w, "%s  %s\n", entry.Opened.Local().Format("2006-01-02 15:04"), entry.Path)
+	}
+}
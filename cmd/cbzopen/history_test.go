@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history.json")
+
+	// a missing file is an empty history
+	history, err := readHistory(path)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("reading a missing history: %v, %v, want it empty", history, err)
+	}
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := range maxHistory + 5 {
+		if err := recordHistory(path, fmt.Sprintf("/books/%d.cbz", i), start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// opening an earlier book again moves it to the top
+	reopened := start.Add(time.Hour)
+	if err := recordHistory(path, "/books/10.cbz", reopened); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != maxHistory {
+		t.Fatalf("%d entries, want %d", len(history), maxHistory)
+	}
+	if history[0].Path != "/books/10.cbz" || !history[0].Opened.Equal(reopened) {
+		t.Errorf("most recent is %+v, want /books/10.cbz opened at %v", history[0], reopened)
+	}
+	seen := map[string]bool{}
+	for _, entry := range history {
+		if seen[entry.Path] {
+			t.Errorf("%s is in the history twice", entry.Path)
+		}
+		seen[entry.Path] = true
+	}
+	// the oldest ones are dropped
+	for _, dropped := range []string{"/books/0.cbz", "/books/4.cbz"} {
+		if seen[dropped] {
+			t.Errorf("%s is still in the history", dropped)
+		}
+	}
+	if last := history[len(history)-1].Path; last != "/books/5.cbz" {
+		t.Errorf("oldest is %s, want /books/5.cbz", last)
+	}
+
+	var printed bytes.Buffer
+	printHistory(&printed, history[:1])
+	if want := reopened.Local().Format("2006-01-02 15:04") + "  /books/10.cbz\n"; printed.String() != want {
+		t.Errorf("printed %q, want %q", printed.String(), want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listen opens a TCP listener on host:port. If port is taken it tries the
+// next ones, up to tries ports in total, so reopening a book while an old
+// instance still holds the port doesn't fail. Port 0 picks any free port.
+func listen(host string, port, tries int) (net.Listener, error) {
+	if port == 0 {
+		return net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+
+	var err error
+	for p := port; p < port+max(tries, 1) && p <= 65535; p++ {
+		var listener net.Listener
+		listener, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p)))
+		if err == nil {
+			if p != port {
+				slog.Info("Port is in use, using the next free one", "requested", port, "port", p)
+			}
+			return listener, nil
+		}
+
+		if !isAddrInUse(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// listenUnix opens a Unix socket at path. A socket file left behind by an
+// instance that didn't shut down cleanly is replaced; one that's still in
+// use is not.
+func listenUnix(path string) (net.Listener, error) {
+	if fileInfo, err := os.Stat(path); err == nil && fileInfo.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			closeWithLog(conn, "socket probe")
+			return nil, errors.New("socket is in use")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// the listener removes the socket file again when the server shuts down
+	return net.Listen("unix", path)
+}
+
+// interfaceAddr returns the address of the network interface name to bind
+// to, see pickAddr, so -interface follows the machine's address as it
+// changes.
+func interfaceAddr(name string, ipv6 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the addresses of %s: %w", name, err)
+	}
+
+	ip := pickAddr(addrs, ipv6)
+	if ip == nil {
+		return nil, fmt.Errorf("%s has no usable address", name)
+	}
+
+	return ip, nil
+}
+
+// pickAddr picks the address to bind to out of an interface's addrs: an
+// IPv4 one if there is, or IPv6 with ipv6 set, falling back to the other kind.
+// Link-local addresses are passed over, since they'd need the interface
+// name in the URL as well. It returns nil if no address is usable.
+func pickAddr(addrs []net.Addr, ipv6 bool) net.IP {
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsUnspecified() {
+			continue
+		}
+
+		isIPv4 := ipNet.IP.To4() != nil
+		if isIPv4 != ipv6 {
+			return ipNet.IP
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenFallback(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeWithLog(busy, "busy listener")
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	// the next free port is used instead
+	listener, err := listen("127.0.0.1", port, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := listener.Addr().(*net.TCPAddr).Port
+	closeWithLog(listener, "listener")
+	if got <= port || got >= port+10 {
+		t.Errorf("listened on %d, want one of the 9 after %d", got, port)
+	}
+
+	// with nowhere else to try, it fails
+	listener, err = listen("127.0.0.1", port, 1)
+	if err == nil {
+		closeWithLog(listener, "listener")
+		t.Errorf("listened on %s with the port taken", listener.Addr())
+	} else if !isAddrInUse(err) {
+		t.Errorf("listening on a taken port: %v, want address in use", err)
+	}
+
+	// port 0 is any free port
+	listener, err = listen("127.0.0.1", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeWithLog(listener, "listener")
+}
+
+func TestListenUnix(t *testing.T) {
+	// socket paths are limited to around 100 bytes, which a test's temp
+	// dir can go over
+	dir, err := os.MkdirTemp("", "cbzopen-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeAllWithLog(dir, "socket directory")
+	socket := filepath.Join(dir, "cbzopen.sock")
+
+	// a socket left behind by an instance that died is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("no Unix sockets here:", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	closeWithLog(stale, "stale listener")
+
+	listener, err := listenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "page")
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://cbzopen/1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	closeWithLog(resp.Body, "response")
+	if err != nil || string(body) != "page" {
+		t.Errorf("over the socket got %q, %v, want %q", body, err, "page")
+	}
+
+	// one that's in use is left alone
+	if listener, err := listenUnix(socket); err == nil {
+		closeWithLog(listener, "listener")
+		t.Error("listened on a socket in use")
+	}
+
+	// and the socket file goes when the server shuts down
+	closeWithLog(server, "server")
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after shutting down: %v", err)
+	}
+}
+
+func TestPickAddr(t *testing.T) {
+	ipNet := func(cidr string) net.Addr {
+		ip, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.IP = ip
+		return n
+	}
+	linkLocal := ipNet("fe80::1/64")
+	v4 := ipNet("192.168.1.5/24")
+	v6 := ipNet("2001:db8::5/64")
+
+	tests := []struct {
+		name  string
+		addrs []net.Addr
+		ipv6  bool
+		want  string
+	}{
+		{name: "ipv4 preferred", addrs: []net.Addr{linkLocal, v6, v4}, want: "192.168.1.5"},
+		{name: "ipv6 preferred", addrs: []net.Addr{v4, v6}, ipv6: true, want: "2001:db8::5"},
+		// the other kind is better than nothing
+		{name: "only ipv6", addrs: []net.Addr{linkLocal, v6}, want: "2001:db8::5"},
+		{name: "only ipv4", addrs: []net.Addr{v4}, ipv6: true, want: "192.168.1.5"},
+		{name: "only link-local", addrs: []net.Addr{linkLocal, ipNet("169.254.1.1/16")}},
+		{name: "not an IPNet", addrs: []net.Addr{&net.IPAddr{IP: net.ParseIP("10.0.0.1")}}},
+		{name: "none"},
+	}
+
+	for _, tt := range tests {
+		got := pickAddr(tt.addrs, tt.ipv6)
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInterfaceAddr(t *testing.T) {
+	// the loopback interface is called lo, lo0 or Loopback Pseudo-Interface 1
+	// depending on the OS, so it's found by its flags
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			continue
+		}
+		ip, err := interfaceAddr(iface.Name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ip.IsLoopback() {
+			t.Errorf("%s: %v, want a loopback address", iface.Name, ip)
+		}
+		break
+	}
+
+	if _, err := interfaceAddr("no-such-interface", false); err == nil {
+		t.Error("no error for an interface that doesn't exist")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// setupLogging makes a slog handler writing to w the default logger. level
+// is one of debug, info, warn or error, and format is text or json.
+func setupLogging(w io.Writer, level, format string) error {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: logLevel}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+// atExit holds cleanups main would otherwise defer, which exit runs since
+// os.Exit skips deferred calls. They're run last added first.
+var atExit []func()
+
+// exit runs atExit and exits with code.
+func exit(code int) {
+	for i := len(atExit) - 1; i >= 0; i-- {
+		atExit[i]()
+	}
+	os.Exit(code)
+}
+
+// fatal logs msg at error level and exits, like log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	exit(1)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		level, format string
+		wantErr       bool
+	}{
+		{level: "info", format: "text"},
+		{level: "DEBUG", format: "json"},
+		{level: "warn", format: "json"},
+		{level: "loud", format: "text", wantErr: true},
+		{level: "info", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := setupLogging(io.Discard, tt.level, tt.format)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("setupLogging(%q, %q): %v, want an error: %v", tt.level, tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+func TestJSONLog(t *testing.T) {
+	page := pageData(t)
+	book := writeZip(t, map[string]string{"1.png": page})
+
+	cmd := mainCommand(t, "-log-format", "json", "-extract-to", filepath.Join(t.TempDir(), "pages"), book)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every line is a JSON object, and opening the book says which
+	var opening map[string]any
+	scanner := bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", scanner.Text(), err)
+		}
+		if line["msg"] == "Opening" {
+			opening = line
+		}
+	}
+	if opening == nil {
+		t.Fatal("no Opening line logged")
+	}
+	if opening["level"] != "INFO" || opening["file"] != book || opening["time"] == nil {
+		t.Errorf("Opening logged as %v, want level INFO, a time and file %s", opening, book)
+	}
+}
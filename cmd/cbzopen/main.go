@@ -0,0 +1,827 @@
+// Command cbzopen opens a comic book archive in the web browser.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"cbzopen"
+)
+
+func closeWithLog(f io.Closer, tag string) {
+	err := f.Close()
+	if err != nil {
+		slog.Warn("Failed to close", "tag", tag, "err", err)
+		return
+	}
+	slog.Debug("Closed", "tag", tag)
+}
+
+func removeAllWithLog(path, tag string) {
+	err := os.RemoveAll(path)
+	if err != nil {
+		slog.Warn("Failed to remove", "tag", tag, "path", path, "err", err)
+	}
+}
+
+// clampPage limits a 1-based page number to the pages available.
+func clampPage(page, count int) int {
+	return max(1, min(page, count))
+}
+
+// displayHost returns the host to use in the printed URL for a server bound
+// to host. Wildcard addresses can't be browsed to, so those fall back to
+// localhost.
+func displayHost(host string) string {
+	ip := net.ParseIP(host)
+	if host == "" || (ip != nil && ip.IsUnspecified()) {
+		return "localhost"
+	}
+
+	return host
+}
+
+// browserCommand returns the command line used to open url. browser is a
+// user supplied command template where {{url}} is replaced by the URL, e.g.
+// "firefox {{url}}"; if it has no {{url}} the URL is appended. An empty
+// browser picks the platform default.
+func browserCommand(browser, url string) []string {
+	if browser == "" {
+		switch runtime.GOOS {
+		case "windows":
+			return []string{"rundll32", "url.dll,FileProtocolHandler", url}
+		case "darwin":
+			return []string{"open", url}
+		default: // "linux", "freebsd", etc.
+			return []string{"xdg-open", url}
+		}
+	}
+
+	args := strings.Fields(browser)
+	substituted := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{{url}}") {
+			args[i] = strings.ReplaceAll(arg, "{{url}}", url)
+			substituted = true
+		}
+	}
+
+	if !substituted {
+		args = append(args, url)
+	}
+
+	return args
+}
+
+// errNoBrowser is returned by openBrowser when there's no command to open
+// the browser with, as on a headless machine without xdg-open.
+var errNoBrowser = errors.New("no browser command found")
+
+func openBrowser(browser, url string) error {
+	args := browserCommand(browser, url)
+	if len(args) == 0 {
+		return errors.New("empty browser command")
+	}
+
+	// Start succeeds as soon as the opener runs, whether or not a browser
+	// shows up, so a missing opener is the one failure that can be told
+	// apart
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("%w: %w", errNoBrowser, err)
+	}
+
+	// exec passes the URL as a single argument, quoted only if it needs to
+	// be, so "#" and "&" reach rundll32 as they are without a shell in
+	// between
+	cmd := exec.Command(args[0], args[1:]...)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// don't leave the opener around as a zombie
+	go func() { _ = cmd.Wait() }()
+
+	return nil
+}
+
+// writeIndex writes the viewer page for filePath to outputPath with write,
+// cbzopen.WriteIndex or cbzopen.Export, or to stdout if it's "-". A file that
+// fails part way is removed.
+func writeIndex(ctx context.Context, filePath, outputPath string, opts cbzopen.Options, write func(context.Context, string, io.Writer, cbzopen.Options) error) error {
+	if outputPath == "-" {
+		return write(ctx, filePath, os.Stdout, opts)
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	err = write(ctx, filePath, f, opts)
+	closeWithLog(f, "index")
+	if err != nil {
+		removeAllWithLog(outputPath, "partial index")
+	}
+
+	return err
+}
+
+// checkArchives writes a line for each archive in paths to w, folders
+// standing for the archives in them, and reports whether all of them are
+// fine.
+func checkArchives(ctx context.Context, paths []string, w io.Writer, opts cbzopen.Options) (bool, error) {
+	ok := true
+	for _, path := range paths {
+		results, err := cbzopen.Check(ctx, path, opts)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, result := range results {
+			ok = ok && result.OK()
+			if _, err := fmt.Fprintln(w, checkReport(result)); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return ok, nil
+}
+
+// checkReport sums up a check result in a line, like
+// "a.cbz: ok, zip, 24 pages, junk: __MACOSX/._001.jpg".
+func checkReport(result cbzopen.CheckResult) string {
+	status := "ok"
+	if !result.OK() {
+		status = "problem"
+	}
+
+	parts := []string{result.Path + ": " + status}
+	if result.Err != nil {
+		return parts[0] + ", " + result.Err.Error()
+	}
+	pages := fmt.Sprintf("%d pages", result.Pages)
+	if result.Pages == 1 {
+		pages = "1 page"
+	}
+	parts = append(parts, result.Format, pages)
+
+	for _, list := range []struct {
+		label string
+		names []string
+	}{
+		{"unsafe", result.Unsafe},
+		{"unreadable", result.Unreadable},
+		{"junk", result.Junk},
+		{"other", result.Other},
+	} {
+		if len(list.names) > 0 {
+			parts = append(parts, list.label+": "+strings.Join(list.names, " "))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// readyTimeout is how long to wait for the server to answer before giving up
+// on opening the browser.
+const readyTimeout = 5 * time.Second
+
+// waitReady polls url until the server answers with anything at all, or
+// timeout passes. Certificates aren't checked, since it's our own server and
+// -tls-cert may well be self-signed.
+func waitReady(ctx context.Context, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	defer client.CloseIdleConnections()
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil {
+			closeWithLog(resp.Body, "readiness probe")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server not ready after %v: %w", timeout, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func main() {
+	filePath := ""
+	flag.StringVar(&filePath, "file", filePath, "cbz file, or a directory of them")
+	host := "localhost"
+	flag.StringVar(&host, "host", host, "address to bind to, e.g. 0.0.0.0 for LAN access")
+	iface := ""
+	flag.StringVar(&iface, "interface", iface, "bind to the address of this network interface, e.g. eth0, instead of -host")
+	ipv6 := false
+	flag.BoolVar(&ipv6, "6", ipv6, "with -interface, prefer its IPv6 address")
+	port := 0
+	flag.IntVar(&port, "port", port, "port to serve on")
+	unixSocket := ""
+	flag.StringVar(&unixSocket, "unix-socket", unixSocket, "listen on this Unix socket instead of TCP, e.g. behind a reverse proxy")
+	preserveStructure := false
+	flag.BoolVar(&preserveStructure, "preserve-structure", preserveStructure, "keep the archive's folders when extracting instead of flattening them")
+	skipErrors := false
+	flag.BoolVar(&skipErrors, "skip-errors", skipErrors, "leave out files that can't be extracted instead of failing")
+	portRange := 10
+	flag.IntVar(&portRange, "port-range", portRange, "how many ports from -port to try if it's in use")
+	watch := false
+	flag.BoolVar(&watch, "watch", watch, "reload the book when its file changes")
+	printURL := false
+	flag.BoolVar(&printURL, "print-url", printURL, "print only the URL to stdout once the server is up, for scripts")
+	open := false
+	flag.BoolVar(&open, "open", open, "open web browser")
+	extract := false
+	flag.BoolVar(&extract, "extract", extract, "extract zip archives to a temporary directory instead of serving them directly")
+	tmpDir := ""
+	flag.StringVar(&tmpDir, "tmp-dir", tmpDir, "directory to put temporary files in (default is the system temp directory)")
+	thumbCache := thumbnailCacheDir()
+	flag.StringVar(&thumbCache, "thumb-cache", thumbCache, "directory to keep thumbnails in between runs, empty to make them afresh each time")
+	keep := false
+	flag.BoolVar(&keep, "keep", keep, "keep the extracted files after exiting and log where they are, implies -extract")
+	inMemory := false
+	flag.BoolVar(&inMemory, "in-memory", inMemory, "read archives into memory instead of extracting them to disk")
+	memoryLimit := cbzopen.DefaultMemoryLimit
+	flag.Var(&memoryLimit, "memory-limit", "largest archive to read into memory with -in-memory, e.g. 512M, 0 for no limit")
+	rtl := false
+	flag.BoolVar(&rtl, "rtl", rtl, "read right-to-left (manga), default is left-to-right")
+	spread := false
+	flag.BoolVar(&spread, "spread", spread, "show two pages side by side")
+	coverSingle := true
+	flag.BoolVar(&coverSingle, "cover-single", coverSingle, "show the cover on its own in spread mode, -cover-single=false pairs from the first page")
+	scroll := false
+	flag.BoolVar(&scroll, "scroll", scroll, "show pages in one continuous vertical strip")
+	slideshow := 0
+	flag.IntVar(&slideshow, "slideshow", slideshow, "turn the page automatically every this many seconds")
+	loop := false
+	flag.BoolVar(&loop, "loop", loop, "start the slideshow over after the last page")
+	preload := 2
+	flag.IntVar(&preload, "preload", preload, "how many pages before and after the current one to load ahead of time")
+	keepZoom := false
+	flag.BoolVar(&keepZoom, "keep-zoom", keepZoom, "keep the zoom level when turning the page")
+	pwa := false
+	flag.BoolVar(&pwa, "pwa", pwa, "let the viewer be installed as an app that keeps the book for reading offline")
+	lang := ""
+	flag.StringVar(&lang, "lang", lang, "language of the viewer: "+strings.Join(cbzopen.Languages, ", ")+" (default is the browser's)")
+	sortOrder := cbzopen.SortFullNatural
+	flag.StringVar(&sortOrder, "sort", sortOrder, "how to order pages by name: "+strings.Join(cbzopen.SortOrders, ", "))
+	dedupe := false
+	flag.BoolVar(&dedupe, "dedupe", dedupe, "load pages that are identical to an earlier one only once")
+	dedupeConsecutive := false
+	flag.BoolVar(&dedupeConsecutive, "dedupe-consecutive", dedupeConsecutive, "also leave out pages identical to the one before (implies -dedupe)")
+	templateFile := ""
+	flag.StringVar(&templateFile, "template", templateFile, "HTML template to use for the viewer instead of the built-in one")
+	maxSize := cbzopen.DefaultMaxSize
+	flag.Var(&maxSize, "max-size", "maximum total size of extracted files, e.g. 500M or 4G, 0 for no limit")
+	filenameEncoding := "shift_jis"
+	flag.StringVar(&filenameEncoding, "filename-encoding", filenameEncoding, "encoding of zip entry names that aren't UTF-8")
+	extList := ""
+	flag.StringVar(&extList, "ext", extList, "extra comma-separated image extensions to show as pages, e.g. bmp,tiff,jxl")
+	autorotate := false
+	flag.BoolVar(&autorotate, "autorotate", autorotate, "rotate JPEG pages upright according to their EXIF orientation")
+	trim := false
+	flag.BoolVar(&trim, "trim", trim, "crop the white or black margins off scanned pages")
+	trimThreshold := cbzopen.DefaultTrimThreshold
+	flag.IntVar(&trimThreshold, "trim-threshold", trimThreshold, "how far (0-255) a pixel may be from the margin color to still count as margin")
+	tlsCert := ""
+	flag.StringVar(&tlsCert, "tls-cert", tlsCert, "TLS certificate file, serves over HTTPS together with -tls-key")
+	tlsKey := ""
+	flag.StringVar(&tlsKey, "tls-key", tlsKey, "TLS key file, serves over HTTPS together with -tls-cert")
+	auth := ""
+	flag.StringVar(&auth, "auth", auth, "require HTTP Basic Auth with the given user:pass")
+	accessLog := false
+	flag.BoolVar(&accessLog, "access-log", accessLog, "log every request: method, path, status, duration and bytes sent")
+	startPage := 0
+	flag.IntVar(&startPage, "page", startPage, "page to open the viewer at")
+	browser := ""
+	flag.StringVar(&browser, "browser", browser, "command to open the browser with, {{url}} is replaced by the URL (default is the system browser)")
+	shutdownTimeout := 5 * time.Second
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "how long to wait for open connections when shutting down")
+	toPDF := ""
+	flag.StringVar(&toPDF, "to-pdf", toPDF, "write the pages to this PDF file instead of serving them")
+	extractTo := ""
+	flag.StringVar(&extractTo, "extract-to", extractTo, "extract the archive to this directory and exit")
+	dumpIndex := ""
+	flag.StringVar(&dumpIndex, "dump-index", dumpIndex, "write the viewer page to this file, or stdout for -, and exit")
+	export := ""
+	flag.StringVar(&export, "export", export, "write the book as one HTML file with the pages in it, or to stdout for -, and exit")
+	check := false
+	flag.BoolVar(&check, "check", check, "check that the archives read through and have pages, and exit")
+	force := false
+	flag.BoolVar(&force, "force", force, "let -extract-to write into a directory that isn't empty")
+	logLevel := "info"
+	flag.StringVar(&logLevel, "log-level", logLevel, "minimum level to log: debug, info, warn or error")
+	logFormat := "text"
+	flag.StringVar(&logFormat, "log-format", logFormat, "log format: text or json")
+	jobs := runtime.GOMAXPROCS(0)
+	flag.IntVar(&jobs, "jobs", jobs, "number of zip entries to extract in parallel")
+	transformJobs := runtime.GOMAXPROCS(0)
+	flag.IntVar(&transformJobs, "transform-jobs", transformJobs, "number of pages to resize or convert at once, 0 for no limit")
+	showVersion := false
+	flag.BoolVar(&showVersion, "version", showVersion, "print the version and exit")
+	showHistory := false
+	flag.BoolVar(&showHistory, "history", showHistory, "list recently opened books and exit")
+	configFile := ""
+	flag.StringVar(&configFile, "config", configFile, "config file (default <user config dir>/cbzopen/config.toml)")
+	flag.Usage = usage
+	command, args, err := parseCommandLine(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fatal("Invalid arguments", "err", err)
+	}
+
+	if showVersion {
+		printVersion(os.Stdout)
+		return
+	}
+
+	if err := applyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		fatal("Invalid environment variable", "err", err)
+	}
+
+	configFile, err = findConfig(configFile)
+	if err != nil {
+		fatal("Failed to find config file", "err", err)
+	}
+
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			fatal("Failed to load config", "file", configFile, "err", err)
+		}
+
+		if err := applyConfig(flag.CommandLine, cfg); err != nil {
+			fatal("Failed to load config", "file", configFile, "err", err)
+		}
+	}
+
+	if printURL {
+		// stdout is being read by a script, keep stderr to what went wrong
+		logLevel = "warn"
+	}
+
+	if err := setupLogging(os.Stderr, logLevel, logFormat); err != nil {
+		fatal("Invalid logging options", "err", err)
+	}
+
+	if showHistory {
+		path, err := historyFile()
+		if err != nil {
+			fatal("Failed to read history", "err", err)
+		}
+
+		history, err := readHistory(path)
+		if err != nil {
+			fatal("Failed to read history", "file", path, "err", err)
+		}
+
+		printHistory(os.Stdout, history)
+		return
+	}
+
+	if (tlsCert == "") != (tlsKey == "") {
+		fatal("-tls-cert and -tls-key must be given together")
+	}
+	useTLS := tlsCert != ""
+	// a certificate that doesn't load would only show once the server is up,
+	// after the book was opened for nothing
+	if useTLS {
+		if _, err := tls.LoadX509KeyPair(tlsCert, tlsKey); err != nil {
+			fatal("Failed to load TLS certificate", "cert", tlsCert, "key", tlsKey, "err", err)
+		}
+	}
+
+	if iface != "" {
+		if unixSocket != "" {
+			fatal("-interface can't be used with -unix-socket")
+		}
+
+		ip, err := interfaceAddr(iface, ipv6)
+		if err != nil {
+			fatal("Invalid -interface", "interface", iface, "err", err)
+		}
+		host = ip.String()
+	}
+
+	if printURL && unixSocket != "" {
+		fatal("-print-url can't be used with -unix-socket")
+	}
+
+	var authUser, authPass string
+	if auth != "" {
+		authUser, authPass, err = parseAuth(auth)
+		if err != nil {
+			fatal("Invalid -auth", "err", err)
+		}
+	}
+
+	// several files are read together, one after the other
+	var sessionFiles []string
+	if filePath == "" {
+		if len(args) > 0 {
+			filePath = args[0]
+		} else {
+			fatal("Required argument 'file' is missing")
+		}
+		if len(args) > 1 {
+			sessionFiles = args
+		}
+	}
+
+	switch command {
+	case "extract":
+		if extractTo == "" {
+			fatal("extract needs -o with the directory to extract to")
+		}
+	case "convert":
+		if toPDF == "" {
+			fatal("convert needs -o with the PDF file to write")
+		}
+	}
+
+	if sessionFiles != nil {
+		if slices.Contains(sessionFiles, "-") {
+			fatal("Can't read stdin together with other files")
+		}
+		if extractTo != "" || toPDF != "" || dumpIndex != "" || export != "" {
+			fatal("-extract-to, -to-pdf, -dump-index and -export take a single file")
+		}
+	}
+
+	if tmpDir != "" {
+		if info, err := os.Stat(tmpDir); err != nil || !info.IsDir() {
+			fatal("-tmp-dir must be an existing directory", "dir", tmpDir)
+		}
+	}
+
+	slog.Info("Opening", "file", filePath, "port", port, "open", open)
+
+	// books read from stdin have nothing to reopen, so stay out of the history
+	fromStdin := filePath == "-"
+
+	// "-" reads the archive from stdin, e.g. piped from curl
+	if fromStdin {
+		stdinPath, err := spoolStdin(os.Stdin, maxSize, tmpDir)
+		if err != nil {
+			fatal("Failed to read stdin", "err", err)
+		}
+		// the copy is removed however main ends, fatal errors included
+		removeStdin := func() { removeAllWithLog(filepath.Dir(stdinPath), "stdin directory") }
+		atExit = append(atExit, removeStdin)
+		defer removeStdin()
+
+		filePath = stdinPath
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		fatal("Failed to open", "file", filePath, "err", err)
+	}
+
+	nameEncoding, err := htmlindex.Get(filenameEncoding)
+	if err != nil {
+		fatal("Unknown -filename-encoding", "encoding", filenameEncoding)
+	}
+
+	if trimThreshold < 0 || trimThreshold > 255 {
+		fatal("-trim-threshold must be between 0 and 255", "trimThreshold", trimThreshold)
+	}
+
+	if preload < 0 {
+		fatal("-preload can't be negative", "preload", preload)
+	}
+
+	if !slices.Contains(cbzopen.SortOrders, sortOrder) {
+		fatal("Unknown -sort", "sort", sortOrder, "supported", strings.Join(cbzopen.SortOrders, ", "))
+	}
+
+	if lang != "" && !slices.Contains(cbzopen.Languages, lang) {
+		fatal("Unknown -lang", "lang", lang, "supported", strings.Join(cbzopen.Languages, ", "))
+	}
+
+	extensions, err := parseExtensions(extList)
+	if err != nil {
+		fatal("Invalid -ext", "err", err)
+	}
+
+	var viewerTemplate *template.Template
+	if templateFile != "" {
+		viewerTemplate, err = cbzopen.LoadTemplate(templateFile)
+		if err != nil {
+			fatal("Invalid -template", "file", templateFile, "err", err)
+		}
+	}
+
+	// an interrupt cancels a long extraction as well as stopping the server
+	// on Windows, os.Interrupt is Ctrl+C or Ctrl+Break and SIGTERM is the
+	// console window closing or the user logging off
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// remember where each book was left off and its bookmarks, except for
+	// ones from stdin since those can't be opened again
+	var positions *positionStore
+	var pageViewed func(string, int)
+	var bookmarks cbzopen.BookmarkStore
+	if !fromStdin {
+		if store, err := newBookmarkStore(); err != nil {
+			slog.Warn("Not saving bookmarks", "err", err)
+		} else {
+			bookmarks = store
+		}
+
+		positions, err = newPositionStore()
+		if err != nil {
+			slog.Warn("Not saving reading positions", "err", err)
+		} else {
+			pageViewed = func(path string, page int) {
+				if err := positions.save(path, page); err != nil {
+					slog.Warn("Failed to save reading position", "file", path, "err", err)
+				}
+			}
+		}
+	}
+
+	// stdout is taken by -print-url's URL or -dump-index's or -export's page
+	var progress func(cbzopen.Progress)
+	if !printURL && dumpIndex != "-" && export != "-" {
+		progress = terminalProgress(os.Stdout)
+	}
+
+	bookOpts := cbzopen.Options{
+		Extract:           extract,
+		Autorotate:        autorotate,
+		Trim:              trim,
+		TrimThreshold:     trimThreshold,
+		MaxSize:           maxSize,
+		FilenameEncoding:  nameEncoding,
+		Jobs:              jobs,
+		TransformJobs:     transformJobs,
+		PreserveStructure: preserveStructure,
+		SkipErrors:        skipErrors,
+		Progress:          progress,
+		TempDir:           tmpDir,
+		ThumbnailCache:    thumbCache,
+		Keep:              keep,
+		InMemory:          inMemory,
+		MemoryLimit:       memoryLimit,
+		ImageExtensions:   extensions,
+		PageViewed:        pageViewed,
+		Bookmarks:         bookmarks,
+		Watch:             watch,
+		RTL:               rtl,
+		Spread:            spread,
+		CoverPaired:       !coverSingle,
+		Scroll:            scroll,
+		Slideshow:         slideshow,
+		Loop:              loop,
+		Preload:           preload,
+		KeepZoom:          keepZoom,
+		Template:          viewerTemplate,
+		PWA:               pwa,
+		Language:          lang,
+		Sort:              sortOrder,
+		Dedupe:            dedupe,
+		DedupeConsecutive: dedupeConsecutive,
+	}
+
+	if check {
+		paths := sessionFiles
+		if paths == nil {
+			paths = []string{filePath}
+		}
+
+		ok, err := checkArchives(ctx, paths, os.Stdout, bookOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fatal("Failed to check", "err", err)
+		}
+		if !ok {
+			exit(1)
+		}
+		return
+	}
+
+	if extractTo != "" {
+		if fileInfo.IsDir() {
+			fatal("-extract-to needs an archive", "file", filePath)
+		}
+
+		if err := prepareExtractDir(extractTo, force); err != nil {
+			fatal("Failed to extract", "file", filePath, "err", err)
+		}
+
+		if err := cbzopen.Extract(ctx, filePath, extractTo, bookOpts); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Extraction interrupted", "file", filePath)
+				return
+			}
+			fatal("Failed to extract", "file", filePath, "err", err)
+		}
+
+		slog.Info("Extracted", "file", filePath, "dir", extractTo)
+		return
+	}
+
+	if toPDF != "" {
+		count, err := cbzopen.ConvertToPDF(ctx, filePath, toPDF, bookOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Extraction interrupted", "file", filePath)
+				return
+			}
+			fatal("Failed to write PDF", "file", toPDF, "err", err)
+		}
+
+		slog.Info("Wrote PDF", "file", toPDF, "pageCount", count)
+		return
+	}
+
+	if dumpIndex != "" {
+		if err := writeIndex(ctx, filePath, dumpIndex, bookOpts, cbzopen.WriteIndex); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Extraction interrupted", "file", filePath)
+				return
+			}
+			fatal("Failed to write index", "file", dumpIndex, "err", err)
+		}
+
+		slog.Info("Wrote index", "file", dumpIndex)
+		return
+	}
+
+	if export != "" {
+		if err := writeIndex(ctx, filePath, export, bookOpts, cbzopen.Export); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Extraction interrupted", "file", filePath)
+				return
+			}
+			fatal("Failed to export", "file", export, "err", err)
+		}
+
+		slog.Info("Exported book", "file", export)
+		return
+	}
+
+	var server *cbzopen.Server
+	if sessionFiles != nil {
+		server, err = cbzopen.NewSessionServer(ctx, sessionFiles, bookOpts)
+	} else {
+		server, err = cbzopen.NewServer(ctx, filePath, bookOpts)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			slog.Info("Extraction interrupted", "file", filePath)
+			return
+		}
+		fatal("Failed to open", "file", filePath, "err", err)
+	}
+
+	if auth != "" {
+		server.RequireAuth(authUser, authPass)
+	}
+	if accessLog {
+		server.LogRequests()
+	}
+
+	if startPage == 0 && positions != nil && !server.IsLibrary() && sessionFiles == nil {
+		saved, err := positions.page(filePath)
+		if err != nil {
+			slog.Warn("Failed to read reading position", "err", err)
+		}
+
+		// the book may have changed since, so quietly stay in range
+		if saved > 0 {
+			startPage = clampPage(saved, server.PageCount())
+			slog.Info("Resuming", "page", startPage)
+		}
+	}
+
+	if !fromStdin {
+		opened := []string{filePath}
+		if sessionFiles != nil {
+			opened = sessionFiles
+		}
+
+		// the history is a convenience, not worth failing over
+		for _, path := range opened {
+			if err := addToHistory(path); err != nil {
+				slog.Warn("Failed to update history", "err", err)
+			}
+		}
+	}
+
+	var listener net.Listener
+	if unixSocket != "" {
+		listener, err = listenUnix(unixSocket)
+	} else {
+		listener, err = listen(host, port, portRange)
+	}
+	if err != nil {
+		server.Close()
+		fatal("Failed to start server", "host", host, "port", port, "socket", unixSocket, "err", err)
+	}
+	if err := server.Serve(listener, tlsCert, tlsKey); err != nil {
+		closeWithLog(listener, "listener")
+		server.Close()
+		fatal("Failed to start server", "err", err)
+	}
+
+	if unixSocket != "" {
+		// there's no URL to open, a reverse proxy is expected in front
+		slog.Info("Starting server", "socket", unixSocket, "tls", useTLS)
+		if open {
+			slog.Warn("-open is ignored with -unix-socket")
+		}
+	} else {
+		listenAddr := listener.Addr().(*net.TCPAddr)
+		if !listenAddr.IP.IsLoopback() && auth == "" {
+			slog.Warn("Serving without -auth, anyone on the network can access it", "host", host)
+		}
+
+		actualPort := listenAddr.Port
+		scheme := "http"
+		if useTLS {
+			scheme = "https"
+		}
+		serverURL := fmt.Sprintf("%s://%s/index.html", scheme, net.JoinHostPort(displayHost(host), strconv.Itoa(actualPort)))
+		if startPage != 0 && !server.IsLibrary() {
+			pageCount := server.PageCount()
+			page := clampPage(startPage, pageCount)
+			if page != startPage {
+				slog.Warn("Page is out of range", "page", startPage, "opening", page, "pageCount", pageCount)
+			}
+			serverURL += fmt.Sprintf("#page-%d", page)
+		}
+		slog.Info("Starting server", "url", serverURL, "port", actualPort, "tls", useTLS)
+		if printURL {
+			fmt.Println(serverURL)
+		}
+
+		if open {
+			if err := waitReady(ctx, serverURL, readyTimeout); err != nil {
+				slog.Error("Not opening web browser", "err", err)
+			} else {
+				slog.Info("Opening web browser")
+				err := openBrowser(browser, serverURL)
+				if errors.Is(err, errNoBrowser) {
+					slog.Warn("Can't open a web browser here, visit the URL yourself", "url", serverURL, "err", err)
+				} else if err != nil {
+					slog.Error("Failed to open browser", "err", err)
+				}
+			}
+		}
+	}
+
+	slog.Info("Press Ctrl+C to stop server")
+
+	<-ctx.Done()
+	// a second Ctrl+C kills the process if shutting down hangs
+	stop()
+
+	slog.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// some client is holding on to its connection, so it was cut off
+		slog.Warn("Shutdown timed out, forced server to close", "timeout", shutdownTimeout, "err", err)
+	} else {
+		slog.Info("Server shut down cleanly")
+	}
+}
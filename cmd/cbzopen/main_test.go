@@ -0,0 +1,415 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mainArgsEnv holds the arguments when the test binary is run as cbzopen by
+// runMain, separated by newlines.
+const mainArgsEnv = "CBZOPEN_TEST_MAIN_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = append([]string{"cbzopen"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// mainCommand returns a command running cbzopen with args in a new process,
+// away from the user's config.
+func mainCommand(t *testing.T, args ...string) *exec.Cmd {
+	t.Helper()
+
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(),
+		mainArgsEnv+"="+strings.Join(args, "\n"),
+		"HOME="+home,
+		"XDG_CONFIG_HOME="+filepath.Join(home, "config"),
+		"XDG_CACHE_HOME="+filepath.Join(home, "cache"),
+	)
+
+	return cmd
+}
+
+// runMain runs cbzopen with args and returns what it printed to stdout and
+// its exit code.
+func runMain(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+
+	cmd := mainCommand(t, args...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stdout.String(), 0
+}
+
+// serveMain starts cbzopen serving with -print-url and args, and returns
+// the URL it printed. The server is stopped when the test ends.
+func serveMain(t *testing.T, args ...string) string {
+	t.Helper()
+
+	cmd := mainCommand(t, append([]string{"-print-url", "-host", "127.0.0.1"}, args...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	url, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("cbzopen %s didn't print a URL: %v", strings.Join(args, " "), err)
+	}
+
+	return strings.TrimSpace(url)
+}
+
+// writeZip writes a cbz holding files, name to contents, and returns its
+// path.
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "book.cbz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// pageData returns a small PNG.
+func pageData(t *testing.T) string {
+	t.Helper()
+
+	var page bytes.Buffer
+	if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 2, 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	return page.String()
+}
+
+func TestCheckExitCode(t *testing.T) {
+	page := pageData(t)
+	good := writeZip(t, map[string]string{"1.png": page, "2.png": page})
+	goodData, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.cbz")
+	if err := os.WriteFile(truncated, goodData[:len(goodData)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notArchive := filepath.Join(t.TempDir(), "notes.cbz")
+	if err := os.WriteFile(notArchive, []byte("not an archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     string
+	}{
+		{name: "good", path: good, wantCode: 0, want: "ok, zip, 2 pages"},
+		{name: "no pages", path: writeZip(t, map[string]string{"notes.txt": "hi"}), wantCode: 1, want: "problem"},
+		{name: "truncated", path: truncated, wantCode: 1, want: "problem"},
+		{name: "not an archive", path: notArchive, wantCode: 1, want: "problem"},
+	}
+
+	for _, tt := range tests {
+		stdout, code := runMain(t, "-check", tt.path)
+		if code != tt.wantCode || !strings.Contains(stdout, tt.want) {
+			t.Errorf("%s: -check exited %d printing %q, want %d and %q", tt.name, code, stdout, tt.wantCode, tt.want)
+		}
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+	upTLS := httptest.NewTLSServer(http.NotFoundHandler())
+	defer upTLS.Close()
+
+	// late starts listening a little after waitReady starts polling
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lateAddr := listener.Addr().String()
+	closeWithLog(listener, "listener")
+	late := &http.Server{Handler: http.NotFoundHandler()}
+	defer late.Close()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		listener, err := net.Listen("tcp", lateAddr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = late.Serve(listener)
+	}()
+
+	// nothing ever listens on down
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := listener.Addr().String()
+	closeWithLog(listener, "listener")
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "up", url: up.URL},
+		{name: "up with TLS", url: upTLS.URL},
+		{name: "late", url: "http://" + lateAddr},
+		{name: "down", url: "http://" + downAddr, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := waitReady(context.Background(), tt.url, 2*time.Second)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s: waitReady: %v, want an error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDisplayHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"", "localhost"},
+		{"localhost", "localhost"},
+		{"0.0.0.0", "localhost"},
+		{"::", "localhost"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"::1", "::1"},
+		{"reader.example", "reader.example"},
+	}
+
+	for _, tt := range tests {
+		if got := displayHost(tt.host); got != tt.want {
+			t.Errorf("displayHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestBrowserCommand(t *testing.T) {
+	const url = "http://localhost:8080/#page-2"
+
+	var platform []string
+	switch runtime.GOOS {
+	case "windows":
+		platform = []string{"rundll32", "url.dll,FileProtocolHandler", url}
+	case "darwin":
+		platform = []string{"open", url}
+	default:
+		platform = []string{"xdg-open", url}
+	}
+
+	tests := []struct {
+		browser string
+		want    []string
+	}{
+		{"", platform},
+		{"firefox", []string{"firefox", url}},
+		{"firefox {{url}}", []string{"firefox", url}},
+		{"firefox  --new-window   {{url}}", []string{"firefox", "--new-window", url}},
+		{"chromium --app={{url}}", []string{"chromium", "--app=" + url}},
+		{"{{url}} {{url}}", []string{url, url}},
+	}
+
+	for _, tt := range tests {
+		if got := browserCommand(tt.browser, url); !slices.Equal(got, tt.want) {
+			t.Errorf("browserCommand(%q) = %q, want %q", tt.browser, got, tt.want)
+		}
+	}
+}
+
+func TestBrowserCommandKeepsURL(t *testing.T) {
+	// "&" would end the command in a shell and "#" start a comment, but the
+	// opener gets the URL as one argument, as it is
+	const url = "https://192.0.2.1:8443/index.html?a=1&b=2#page-3"
+
+	for _, browser := range []string{"", "firefox", "firefox --new-window {{url}}"} {
+		args := browserCommand(browser, url)
+		if args[len(args)-1] != url {
+			t.Errorf("browserCommand(%q) = %q, want the URL intact at the end", browser, args)
+		}
+	}
+}
+
+func TestStartPage(t *testing.T) {
+	page := pageData(t)
+	book := writeZip(t, map[string]string{"1.png": page, "2.png": page, "3.png": page})
+
+	tests := []struct {
+		page string
+		want string
+	}{
+		{page: "0", want: "/index.html"},
+		{page: "2", want: "/index.html#page-2"},
+		// out of range pages open the nearest one there is
+		{page: "7", want: "/index.html#page-3"},
+		{page: "-1", want: "/index.html#page-1"},
+	}
+
+	for _, tt := range tests {
+		url := serveMain(t, "-page", tt.page, book)
+		if !strings.HasPrefix(url, "http://127.0.0.1:") || !strings.HasSuffix(url, tt.want) {
+			t.Errorf("-page %s: URL %s, want one ending in %s", tt.page, url, tt.want)
+		}
+	}
+}
+
+func TestPrintURL(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't interrupt a process on Windows")
+	}
+
+	book := writeZip(t, map[string]string{"1.png": pageData(t)})
+	cmd := mainCommand(t, "-print-url", "-host", "127.0.0.1", book)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the URL, then stop the server the way a script would
+	stdout := bufio.NewReader(pipe)
+	url, err := stdout.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("cbzopen: %v\n%s", err, stderr.String())
+	}
+
+	// the URL is all that's printed to stdout, and only what went wrong
+	// to stderr
+	if !strings.HasPrefix(url, "http://127.0.0.1:") || !strings.HasSuffix(url, "/index.html\n") || len(rest) > 0 {
+		t.Errorf("stdout %q, want just the URL", url+string(rest))
+	}
+	if strings.Contains(stderr.String(), "level=INFO") {
+		t.Errorf("stderr %q, want no info logs", stderr.String())
+	}
+}
+
+func TestNoBrowser(t *testing.T) {
+	const browser = "cbzopen-test-no-such-browser"
+
+	if err := openBrowser(browser, "http://localhost:8080/"); !errors.Is(err, errNoBrowser) {
+		t.Errorf("openBrowser with no such command: %v, want %v", err, errNoBrowser)
+	}
+
+	// cbzopen says to visit the URL, and goes on serving
+	book := writeZip(t, map[string]string{"1.png": pageData(t)})
+	cmd := mainCommand(t, "-open", "-browser", browser, "-host", "127.0.0.1", "-print-url", book)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	url, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	warned := false
+	for scanner := bufio.NewScanner(stderr); scanner.Scan(); {
+		if strings.Contains(scanner.Text(), "visit the URL yourself") {
+			warned = true
+			break
+		}
+	}
+	if !warned {
+		t.Fatal("no message saying to visit the URL")
+	}
+
+	resp, err := http.Get(strings.TrimSpace(url))
+	if err != nil {
+		t.Fatalf("not serving after failing to open a browser: %v", err)
+	}
+	closeWithLog(resp.Body, "response")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// detach starts cmd in its own process group, so Ctrl+C in the terminal
+// doesn't also reach the browser.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestDetach(t *testing.T) {
+	path, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep command:", err)
+	}
+
+	cmd := exec.Command(path, "5")
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	// a group of its own, so Ctrl+C in the terminal doesn't reach it
+	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pgid != cmd.Process.Pid || pgid == syscall.Getpgrp() {
+		t.Errorf("opener in process group %d, want its own, %d", pgid, cmd.Process.Pid)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// wsaeaddrinuse is WSAEADDRINUSE, which Windows returns for a port that's
+// taken instead of anything matching syscall.EADDRINUSE.
+const wsaeaddrinuse = syscall.Errno(10048)
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeaddrinuse) || errors.Is(err, syscall.EADDRINUSE)
+}
+
+// detach starts cmd in its own process group, so Ctrl+C in our console
+// doesn't also reach the browser.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
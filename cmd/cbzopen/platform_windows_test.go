@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestIsAddrInUse(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: fmt.Errorf("listen: %w", wsaeaddrinuse), want: true},
+		{err: syscall.EADDRINUSE, want: true},
+		{err: syscall.ECONNREFUSED, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isAddrInUse(tt.err); got != tt.want {
+			t.Errorf("isAddrInUse(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDetach(t *testing.T) {
+	cmd := exec.Command("rundll32")
+	detach(cmd)
+
+	// a group of its own, so Ctrl+C in the console doesn't reach it
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.CreationFlags&syscall.CREATE_NEW_PROCESS_GROUP == 0 {
+		t.Errorf("SysProcAttr %+v, want a new process group", cmd.SysProcAttr)
+	}
+}
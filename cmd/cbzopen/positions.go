@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// bookKey identifies a book in the state files by a hash of its absolute
+// path, so they don't list what's been read.
+func bookKey(bookPath string) (string, error) {
+	absPath, err := filepath.Abs(bookPath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(absPath))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// positionStore remembers the page each book was last read at, in a JSON
+// file mapping each book's key to the page number.
+type positionStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newPositionStore() (*positionStore, error) {
+	path, err := stateFile("positions.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &positionStore{path: path}, nil
+}
+
+// page returns the saved page for bookPath, or 0 if there isn't one.
+func (s *positionStore) page(bookPath string) (int, error) {
+	key, err := bookKey(bookPath)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	positions := map[string]int{}
+	if err := readState(s.path, &positions); err != nil {
+		return 0, err
+	}
+
+	return positions[key], nil
+}
+
+func (s *positionStore) save(bookPath string, page int) error {
+	key, err := bookKey(bookPath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	positions := map[string]int{}
+	if err := readState(s.path, &positions); err != nil {
+		return err
+	}
+	positions[key] = page
+
+	return writeState(s.path, positions)
+}
+
+// bookmarkStore is a cbzopen.BookmarkStore keeping each book's bookmarked
+// pages in a JSON file, by the book's key.
+type bookmarkStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newBookmarkStore() (*bookmarkStore, error) {
+	path, err := stateFile("bookmarks.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &bookmarkStore{path: path}, nil
+}
+
+func (s *bookmarkStore) Bookmarks(bookPath string) ([]int, error) {
+	key, err := bookKey(bookPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmarks := map[string][]int{}
+	if err := readState(s.path, &bookmarks); err != nil {
+		return nil, err
+	}
+
+	pages := bookmarks[key]
+	if pages == nil {
+		pages = []int{}
+	}
+
+	return pages, nil
+}
+
+func (s *bookmarkStore) AddBookmark(bookPath string, page int) error {
+	return s.update(bookPath, func(pages []int) []int {
+		if slices.Contains(pages, page) {
+			return pages
+		}
+
+		pages = append(pages, page)
+		slices.Sort(pages)
+		return pages
+	})
+}
+
+func (s *bookmarkStore) RemoveBookmark(bookPath string, page int) error {
+	return s.update(bookPath, func(pages []int) []int {
+		return slices.DeleteFunc(pages, func(p int) bool { return p == page })
+	})
+}
+
+// update replaces the bookmarks of bookPath with what fn makes of them.
+func (s *bookmarkStore) update(bookPath string, fn func([]int) []int) error {
+	key, err := bookKey(bookPath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmarks := map[string][]int{}
+	if err := readState(s.path, &bookmarks); err != nil {
+		return err
+	}
+
+	pages := fn(bookmarks[key])
+	if len(pages) == 0 {
+		delete(bookmarks, key)
+	} else {
+		bookmarks[key] = pages
+	}
+
+	return writeState(s.path, bookmarks)
+}
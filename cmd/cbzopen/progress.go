@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cbzopen"
+)
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or file.
+func isTerminal(f *os.File) bool {
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalProgress returns an Options.Progress callback that keeps a
+// one-line status on f, or nil if f isn't a terminal.
+func terminalProgress(f *os.File) func(cbzopen.Progress) {
+	if !isTerminal(f) {
+		return nil
+	}
+
+	// pad over what's left of the last line rather than clearing it with an
+	// escape code, which older Windows consoles print as is
+	width := 0
+	return func(p cbzopen.Progress) {
+		line := fmt.Sprintf("Extracting %d / %d files, %s", p.Files, p.Total, p.Bytes.Approx())
+		if p.Total == 0 {
+			line = fmt.Sprintf("Extracting %d files, %s", p.Files, p.Bytes.Approx())
+		}
+		fmt.Fprintf(f, "\r%-*s", width, line)
+		width = max(width, len(line))
+		if p.Total > 0 && p.Files >= p.Total {
+			fmt.Fprintln(f)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// stateDir returns the directory for cbzopen's state, like the history:
+// $XDG_STATE_HOME/cbzopen, ~/.local/state/cbzopen on other Unix systems and
+// the user config dir elsewhere.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "cbzopen"), nil
+	}
+
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "state", "cbzopen"), nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "cbzopen"), nil
+}
+
+// thumbnailCacheDir returns where thumbnails are kept between runs unless
+// -thumb-cache says otherwise: cbzopen/thumbnails in the user cache dir, or
+// nowhere if there isn't one.
+func thumbnailCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(cacheDir, "cbzopen", "thumbnails")
+}
+
+// stateFile returns the path of the state file with the given name.
+func stateFile(name string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find state directory: %w", err)
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// readState decodes the JSON state file at path into v. A missing file
+// leaves v as it is.
+func readState(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeState replaces the state file at path with v as JSON.
+func writeState(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// write next to it and rename, so a crash can't leave half a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
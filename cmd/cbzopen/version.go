@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// version and commit can be set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=abc1234" ./cmd/cbzopen
+//
+// Otherwise they're filled in from the build info Go embeds in the binary.
+var (
+	version = ""
+	commit  = ""
+)
+
+func printVersion(w io.Writer) {
+	v, c := version, commit
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" {
+			v = info.Main.Version
+		}
+
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && c == "" {
+				c = setting.Value
+			}
+		}
+	}
+
+	if v == "" {
+		v = "(devel)"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+
+	fmt.Fprintf(w, "cbzopen %s\ncommit: %s\ngo: %s\n", v, c, runtime.Version())
+}
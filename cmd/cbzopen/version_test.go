@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	// it prints and exits, rather than going on to serve
+	stdout, code := runMain(t, "-version")
+	if code != 0 {
+		t.Errorf("-version exited %d", code)
+	}
+	for _, want := range []string{"cbzopen ", "\ncommit: ", "\ngo: " + runtime.Version() + "\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("-version printed %q, want it to contain %q", stdout, want)
+		}
+	}
+
+	// what's set at build time wins over the build info
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+	version, commit = "v1.2.0", "abc1234"
+	var printed bytes.Buffer
+	printVersion(&printed)
+	if want := "cbzopen v1.2.0\ncommit: abc1234\n"; !strings.HasPrefix(printed.String(), want) {
+		t.Errorf("printed %q, want it to start with %q", printed.String(), want)
+	}
+}
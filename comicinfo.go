@@ -0,0 +1,176 @@
+package cbzopen
+
+import (
+	"encoding/xml"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// comicInfo holds the commonly used fields of a ComicInfo.xml file, the de
+// facto metadata format for comic archives.
+type comicInfo struct {
+	Title       string `xml:"Title"`
+	Series      string `xml:"Series"`
+	Number      string `xml:"Number"`
+	Count       string `xml:"Count"`
+	Volume      string `xml:"Volume"`
+	Summary     string `xml:"Summary"`
+	Year        string `xml:"Year"`
+	Month       string `xml:"Month"`
+	Writer      string `xml:"Writer"`
+	Penciller   string `xml:"Penciller"`
+	Inker       string `xml:"Inker"`
+	Colorist    string `xml:"Colorist"`
+	Letterer    string `xml:"Letterer"`
+	CoverArtist string `xml:"CoverArtist"`
+	Editor      string `xml:"Editor"`
+	Publisher   string `xml:"Publisher"`
+	Genre       string `xml:"Genre"`
+	LanguageISO string `xml:"LanguageISO"`
+	// Pages describes individual pages, e.g. which one is the cover
+	Pages []comicPage `xml:"Pages>Page"`
+}
+
+// comicPage is a page entry of ComicInfo.xml. Image is the index of the
+// page's file among the archive's pages sorted by name.
+type comicPage struct {
+	Image int    `xml:"Image,attr"`
+	Type  string `xml:"Type,attr"`
+}
+
+// coverPage picks the cover out of pages, which are sorted by name: the one
+// info marks as the front cover, or else the first.
+func coverPage(pages []string, info comicInfo) (string, bool) {
+	if len(pages) == 0 {
+		return "", false
+	}
+
+	for _, page := range info.Pages {
+		if page.Type == "FrontCover" && page.Image >= 0 && page.Image < len(pages) {
+			return pages[page.Image], true
+		}
+	}
+
+	return pages[0], true
+}
+
+// orderPages puts pages, sorted by name, in the order they're listed in
+// info, followed by any that aren't listed. Entries for pages that don't
+// exist, or that list a page twice, are skipped.
+func orderPages(pages []string, info comicInfo) []string {
+	if len(info.Pages) == 0 {
+		return pages
+	}
+
+	ordered := make([]string, 0, len(pages))
+	listed := make([]bool, len(pages))
+	skipped := 0
+	for _, page := range info.Pages {
+		if page.Image < 0 || page.Image >= len(pages) || listed[page.Image] {
+			skipped++
+			continue
+		}
+
+		listed[page.Image] = true
+		ordered = append(ordered, pages[page.Image])
+	}
+	if skipped > 0 {
+		slog.Warn("Skipped ComicInfo.xml pages that don't match the archive", "count", skipped, "pageCount", len(pages))
+	}
+
+	for i, name := range pages {
+		if !listed[i] {
+			ordered = append(ordered, name)
+		}
+	}
+
+	return ordered
+}
+
+type infoField struct {
+	Label string
+	Value string
+}
+
+// Details lists the non-empty fields for the viewer's metadata panel, in the
+// order they're shown.
+func (c comicInfo) Details() []infoField {
+	fields := []infoField{
+		{"Series", c.Series},
+		{"Number", c.Number},
+		{"Volume", c.Volume},
+		{"Year", c.Year},
+		{"Writer", c.Writer},
+		{"Penciller", c.Penciller},
+		{"Inker", c.Inker},
+		{"Colorist", c.Colorist},
+		{"Letterer", c.Letterer},
+		{"Cover Artist", c.CoverArtist},
+		{"Editor", c.Editor},
+		{"Publisher", c.Publisher},
+		{"Genre", c.Genre},
+		{"Summary", c.Summary},
+	}
+
+	var details []infoField
+	for _, field := range fields {
+		if field.Value != "" {
+			details = append(details, field)
+		}
+	}
+
+	return details
+}
+
+// readComicInfo parses ComicInfo.xml from the top level of pages, matching
+// the name case-insensitively. Archives without one, or with one that can't
+// be parsed, get the archive's file name as their title.
+func readComicInfo(pages fs.FS, archivePath string) comicInfo {
+	name, ok := findComicInfo(pages)
+	if !ok {
+		return decodeComicInfo(nil, "", archivePath)
+	}
+
+	data, err := fs.ReadFile(pages, name)
+	if err != nil {
+		slog.Warn("Failed to read ComicInfo.xml", "file", name, "err", err)
+		return decodeComicInfo(nil, "", archivePath)
+	}
+
+	return decodeComicInfo(data, name, archivePath)
+}
+
+// decodeComicInfo is readComicInfo for the ComicInfo.xml called name that
+// holds data, or for an archive without one if data is nil.
+func decodeComicInfo(data []byte, name, archivePath string) comicInfo {
+	var info comicInfo
+	if data != nil {
+		if err := xml.Unmarshal(data, &info); err != nil {
+			slog.Warn("Failed to read ComicInfo.xml", "file", name, "err", err)
+			info = comicInfo{}
+		}
+	}
+
+	if info.Title == "" {
+		info.Title = strings.TrimSuffix(filepath.Base(archivePath), filepath.Ext(archivePath))
+	}
+
+	return info
+}
+
+func findComicInfo(pages fs.FS) (string, bool) {
+	entries, err := fs.ReadDir(pages, ".")
+	if err != nil {
+		return "", false
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(entry.Name(), "ComicInfo.xml") {
+			return entry.Name(), true
+		}
+	}
+
+	return "", false
+}
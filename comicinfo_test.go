@@ -0,0 +1,134 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadComicInfo(t *testing.T) {
+	full := `<?xml version="1.0"?>
+<ComicInfo>
+  <Title>The Long Night</Title>
+  <Series>Nightwatch</Series>
+  <Number>3</Number>
+  <Writer>A. Writer</Writer>
+  <Pages>
+    <Page Image="0" Type="FrontCover"/>
+    <Page Image="2"/>
+  </Pages>
+</ComicInfo>`
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  comicInfo
+	}{
+		{
+			name:  "full",
+			files: fstest.MapFS{"ComicInfo.xml": {Data: []byte(full)}},
+			want: comicInfo{
+				Title:  "The Long Night",
+				Series: "Nightwatch",
+				Number: "3",
+				Writer: "A. Writer",
+				Pages:  []comicPage{{Image: 0, Type: "FrontCover"}, {Image: 2}},
+			},
+		},
+		{
+			name:  "lowercase name",
+			files: fstest.MapFS{"comicinfo.xml": {Data: []byte(`<ComicInfo><Series>Nightwatch</Series></ComicInfo>`)}},
+			want:  comicInfo{Title: "book", Series: "Nightwatch"},
+		},
+		{
+			name:  "missing",
+			files: fstest.MapFS{"1.png": {}},
+			want:  comicInfo{Title: "book"},
+		},
+		{
+			name:  "not xml",
+			files: fstest.MapFS{"ComicInfo.xml": {Data: []byte("<ComicInfo><Title>")}},
+			want:  comicInfo{Title: "book"},
+		},
+		{
+			name:  "in a folder",
+			files: fstest.MapFS{"extras/ComicInfo.xml": {Data: []byte(full)}},
+			want:  comicInfo{Title: "book"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := readComicInfo(tt.files, "/comics/book.cbz")
+		if got.Title != tt.want.Title || got.Series != tt.want.Series || got.Number != tt.want.Number ||
+			got.Writer != tt.want.Writer || !slices.Equal(got.Pages, tt.want.Pages) {
+			t.Errorf("%s: readComicInfo = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderPages(t *testing.T) {
+	pages := []string{"1.png", "2.png", "10.png"}
+	listed := func(images ...int) comicInfo {
+		var info comicInfo
+		for _, image := range images {
+			info.Pages = append(info.Pages, comicPage{Image: image})
+		}
+		return info
+	}
+
+	tests := []struct {
+		name string
+		info comicInfo
+		want []string
+	}{
+		{name: "none listed", info: comicInfo{}, want: []string{"1.png", "2.png", "10.png"}},
+		{name: "all listed", info: listed(2, 0, 1), want: []string{"10.png", "1.png", "2.png"}},
+		{name: "some listed", info: listed(1), want: []string{"2.png", "1.png", "10.png"}},
+		{name: "missing and repeated", info: listed(2, 7, -1, 2, 0), want: []string{"10.png", "1.png", "2.png"}},
+	}
+
+	for _, tt := range tests {
+		if got := orderPages(pages, tt.info); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: orderPages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBookPageOrder(t *testing.T) {
+	page := pngData(t, color.White)
+	tests := []struct {
+		name      string
+		comicInfo string
+		want      []string
+	}{
+		{name: "natural", want: []string{"page1.png", "page2.png", "page10.png"}},
+		{
+			name:      "ComicInfo.xml",
+			comicInfo: `<ComicInfo><Pages><Page Image="2"/><Page Image="0"/><Page Image="1"/></Pages></ComicInfo>`,
+			want:      []string{"page10.png", "page1.png", "page2.png"},
+		},
+	}
+
+	for _, tt := range tests {
+		entries := []testEntry{{name: "page10.png", data: page}, {name: "page2.png", data: page}, {name: "page1.png", data: page}}
+		if tt.comicInfo != "" {
+			entries = append(entries, testEntry{name: "ComicInfo.xml", data: tt.comicInfo})
+		}
+		archivePath := writeZip(t, entries)
+
+		// served in place, in memory and extracted
+		for _, opts := range []Options{{}, {InMemory: true}, {Extract: true}} {
+			opts.TempDir = t.TempDir()
+			b, err := openBook(context.Background(), archivePath, opts.book())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(b.imageFiles, tt.want) {
+				t.Errorf("%s %+v: pages %v, want %v", tt.name, opts, b.imageFiles, tt.want)
+			}
+			b.Close()
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package cbzopen
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// compressedTypes are the responses worth gzipping. Pages are left alone,
+// image formats are compressed already.
+var compressedTypes = []string{"text/html", "application/json", "application/atom+xml"}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip. An
+// explicit gzip entry wins over "*", whichever comes first, and either one
+// with q=0 rules gzip out.
+func acceptsGzip(header string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for part := range strings.SplitSeq(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzipQ = qValue(params)
+		case "*":
+			anyQ = qValue(params)
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+
+	return anyQ > 0
+}
+
+// qValue returns the q parameter among params, like "q=0.5", or 1 if there
+// isn't a valid one.
+func qValue(params string) float64 {
+	for param := range strings.SplitSeq(params, ";") {
+		name, value, _ := strings.Cut(param, "=")
+		if !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 1
+		}
+		return q
+	}
+
+	return 1
+}
+
+// compress gzips the text responses of next for clients that accept it.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter decides whether to compress once the headers are
+// written, going by the response's Content-Type.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if w.shouldCompress(status) {
+		// the length is of the uncompressed body, and the same ETag can't
+		// stand for both encodings
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) shouldCompress(status int) bool {
+	// partial content is a range of the uncompressed body
+	if status != http.StatusOK {
+		return false
+	}
+
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && slices.Contains(compressedTypes, mediaType)
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// like net/http, fill in the type before it's needed to decide
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends what's been compressed so far, for streamed responses.
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
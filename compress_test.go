@@ -0,0 +1,36 @@
+package cbzopen
+
+import "testing"
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"gzip, deflate, br", true},
+		{"deflate, br", false},
+		{"br;q=1.0, gzip;q=0.8", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"gzip;level=1;q=0", false},
+		{"*", true},
+		{"*;q=0", false},
+		// an explicit gzip wins over *, in either order
+		{"*;q=0, gzip", true},
+		{"gzip, *;q=0", true},
+		{"*, gzip;q=0", false},
+		{"gzip;q=0, *", false},
+		{"identity, *;q=0.5", true},
+		// a q-value that doesn't parse is taken as 1
+		{"gzip;q=high", true},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
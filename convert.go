@@ -0,0 +1,158 @@
+package cbzopen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// accepts reports whether the Accept header names mediaType itself. Wildcards
+// like image/* don't count, browsers send them whether they can show the
+// format or not.
+func accepts(header, mediaType string) bool {
+	for part := range strings.SplitSeq(header, ",") {
+		accepted, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && accepted == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// converter turns AVIF and JPEG XL pages into JPEG (or PNG, when they have
+// transparency) for browsers that can't show them. Each page is converted on
+// first request and cached in dir, or converted every time if dir is "".
+// No more than limit are converted at once.
+type converter struct {
+	pages fs.FS
+	dir   string
+	limit limiter
+}
+
+// fallback serves pages through the converter when the browser doesn't
+// accept their format, and everything else through next.
+func (c *converter) fallback(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		mediaType, ok := convertedTypes[strings.ToLower(path.Ext(name))]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if accepts(r.Header.Get("Accept"), mediaType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, err := fs.Stat(c.pages, name); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the ETag is for the original file
+		w.Header().Del("ETag")
+		err := c.sendConverted(w, r, name)
+		if errors.Is(err, errBusy) {
+			// the browser can't show the original, so there's nothing
+			// better to send
+			tooBusy(w)
+		} else if err != nil {
+			slog.Warn("Failed to convert page", "file", name, "err", err)
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// sendConverted sends name converted. Nothing is written to w if it fails.
+func (c *converter) sendConverted(w http.ResponseWriter, r *http.Request, name string) error {
+	if c.dir == "" {
+		var converted bytes.Buffer
+		ext, err := c.encodeConverted(&converted, name)
+		if err != nil {
+			return err
+		}
+
+		http.ServeContent(w, r, "converted"+ext, time.Time{}, bytes.NewReader(converted.Bytes()))
+		return nil
+	}
+
+	convertedPath, err := c.converted(name)
+	if err != nil {
+		return err
+	}
+
+	http.ServeFile(w, r, convertedPath)
+	return nil
+}
+
+// encodeConverted decodes name and writes it to w as JPEG, or PNG if it has
+// transparency, returning the extension for the format used. It returns
+// errBusy if the limiter is full.
+func (c *converter) encodeConverted(w io.Writer, name string) (string, error) {
+	if !c.limit.tryAcquire() {
+		return "", errBusy
+	}
+	defer c.limit.release()
+
+	f, err := c.pages.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer closeWithLog(f, "page")
+
+	img, _, err := decodeImage(f)
+	if err != nil {
+		return "", err
+	}
+
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		return ".png", png.Encode(w, img)
+	}
+
+	return ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+}
+
+func (c *converter) converted(name string) (string, error) {
+	sum := sha256.Sum256([]byte(name))
+	base := filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+	for _, ext := range []string{".jpg", ".png"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext, nil
+		}
+	}
+
+	// write to a temporary file first so a concurrent request never serves a
+	// half written image
+	tmpFile, err := os.CreateTemp(c.dir, "convert-")
+	if err != nil {
+		return "", err
+	}
+
+	ext, err := c.encodeConverted(tmpFile, name)
+	closeWithLog(tmpFile, "converted image")
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), base+ext)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	return base + ext, nil
+}
@@ -0,0 +1,15 @@
+//go:build (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64)) || darwin || windows || (netbsd && (amd64 || arm64))
+
+package cbzopen
+
+import (
+	_ "github.com/gen2brain/avif"
+	_ "github.com/gen2brain/jpegxl"
+)
+
+// convertedTypes are the page formats not every browser can show, which are
+// converted for browsers that don't list them in their Accept header.
+var convertedTypes = map[string]string{
+	".avif": "image/avif",
+	".jxl":  "image/jxl",
+}
@@ -0,0 +1,7 @@
+//go:build !((linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64)) || darwin || windows || (netbsd && (amd64 || arm64)))
+
+package cbzopen
+
+// convertedTypes is empty where the AVIF and JPEG XL decoders don't build,
+// so those pages are always sent as they are.
+var convertedTypes = map[string]string{}
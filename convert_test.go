@@ -0,0 +1,69 @@
+//go:build (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64)) || darwin || windows || (netbsd && (amd64 || arm64))
+
+package cbzopen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gen2brain/avif"
+)
+
+func TestConverterFallback(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(0, 0, color.RGBA{R: 0xff, A: 0xff})
+
+	var page bytes.Buffer
+	if err := avif.Encode(&page, img); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := fstest.MapFS{"001.avif": {Data: page.Bytes()}}
+	c := &converter{pages: pages}
+	handler := c.fallback(http.FileServerFS(pages))
+
+	tests := []struct {
+		accept   string
+		wantType string
+	}{
+		{accept: "image/avif,image/webp,image/png,*/*;q=0.8", wantType: "image/avif"},
+		{accept: "image/webp,image/png,image/*;q=0.8,*/*;q=0.5", wantType: "image/jpeg"},
+		{accept: "", wantType: "image/jpeg"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/001.avif", nil)
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status %d, want %d", tt.accept, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("Accept %q: Content-Type %q, want %q", tt.accept, got, tt.wantType)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("Accept %q: Vary %q, want Accept", tt.accept, got)
+		}
+
+		sent := w.Body.Bytes()
+		if tt.wantType == "image/avif" {
+			if !bytes.Equal(sent, page.Bytes()) {
+				t.Errorf("Accept %q: the page wasn't sent as it is", tt.accept)
+			}
+			continue
+		}
+		if _, format, err := image.Decode(bytes.NewReader(sent)); err != nil || format != "jpeg" {
+			t.Errorf("Accept %q: sent %q, %v, want a jpeg", tt.accept, format, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package cbzopen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+	"golang.org/x/text/encoding"
+)
+
+// coverPlaceholder stands in for archives without a cover we can decode.
+const coverPlaceholder = `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="300" viewBox="0 0 200 300">` +
+	`<rect width="200" height="300" fill="#333"/>` +
+	`<path d="M70 110h60v80h-60z" fill="none" stroke="#666" stroke-width="4"/>` +
+	`</svg>`
+
+// openArchiveFS opens an archive for reading a few files out of it without
+// extracting the whole thing, like its cover. Zip entry names are decoded
+// with enc. Reading all of them goes through walkEntries instead.
+func openArchiveFS(archivePath string, enc encoding.Encoding) (fs.FS, func(), error) {
+	format, err := detectFormat(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch format {
+	case formatZip:
+		z, err := openZipFS(archivePath, enc, nil, naturalCompare)
+		if err != nil {
+			return nil, nil, err
+		}
+		return z, func() { closeWithLog(z, "archiveFS") }, nil
+	case formatRar:
+		r, err := rardecode.OpenFS(archivePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, func() {}, nil
+	case formatSevenZip:
+		r, err := sevenzip.OpenReader(archivePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, func() { closeWithLog(r, "archive") }, nil
+	case formatTar:
+		t, err := openTarFS(archivePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t, func() {}, nil
+	default:
+		return nil, nil, errors.New("unsupported archive format")
+	}
+}
+
+// readCover decodes the cover of the archive at archivePath, or of the
+// images directly in it if it's a folder.
+func readCover(archivePath string, opts bookOptions) (image.Image, error) {
+	fileInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var archiveFS fs.FS
+	var names []string
+	var info comicInfo
+	if fileInfo.IsDir() {
+		names, err = topLevelFiles(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		// a folder is read like its album is served, its pages and nothing
+		// else; the loose images' album is the whole library folder
+		dirFS := os.DirFS(archivePath)
+		info = readComicInfo(dirFS, archivePath)
+		names = imagePagesFS(dirFS, names, opts.extensions, opts.order)
+		archiveFS = newImageDirFS(archivePath, names, nil)
+	} else {
+		var closeArchive func()
+		archiveFS, closeArchive, err = openArchiveFS(archivePath, opts.extraction.filenameEncoding)
+		if err != nil {
+			return nil, err
+		}
+		defer closeArchive()
+
+		err = fs.WalkDir(archiveFS, ".", func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		info = readComicInfo(archiveFS, archivePath)
+	}
+
+	name, ok := coverPage(imagePagesFS(archiveFS, names, opts.extensions, opts.order), info)
+	if !ok {
+		return nil, ErrNoPages
+	}
+
+	f, err := archiveFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeWithLog(f, "cover")
+
+	img, _, err := decodeImage(f)
+	return img, err
+}
+
+// coverThumbnail returns the path of the cached cover thumbnail for the
+// archive name in the library, generating it on first use. Covers share the
+// limiter with the books' pages, waiting for a slot until ctx is done.
+func (l *library) coverThumbnail(ctx context.Context, name string) (string, error) {
+	sum := sha256.Sum256([]byte(name))
+	thumbPath := filepath.Join(l.coverDir, hex.EncodeToString(sum[:])+".jpg")
+
+	if _, err := os.Stat(thumbPath); err == nil {
+		return thumbPath, nil
+	}
+
+	if err := l.opts.transforms.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer l.opts.transforms.release()
+
+	img, err := readCover(l.paths[name], l.opts)
+	if err != nil {
+		return "", err
+	}
+
+	// write to a temporary file first so a concurrent request never serves a
+	// half written image
+	tmpFile, err := os.CreateTemp(l.coverDir, "cover-")
+	if err != nil {
+		return "", err
+	}
+
+	err = jpeg.Encode(tmpFile, scaleToWidth(img, thumbnailWidth), &jpeg.Options{Quality: 80})
+	closeWithLog(tmpFile, "cover")
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), thumbPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	return thumbPath, nil
+}
+
+// serveCover handles /covers/<name>, a thumbnail of the archive's cover for
+// the landing page.
+func (l *library) serveCover(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(l.names, name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(pageMaxAge))
+
+	thumbPath, err := l.coverThumbnail(r.Context(), name)
+	if err != nil {
+		slog.Debug("No cover", "file", name, "err", err)
+		w.Header().Set("Content-Type", "image/svg+xml")
+		_, _ = w.Write([]byte(coverPlaceholder))
+		return
+	}
+
+	http.ServeFile(w, r, thumbPath)
+}
@@ -0,0 +1,53 @@
+package cbzopen
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCoverFrontCover(t *testing.T) {
+	comicInfoXML := `<ComicInfo><Pages><Page Image="1" Type="FrontCover"/></Pages></ComicInfo>`
+	archivePath := writeZip(t, []testEntry{
+		{name: "1.png", data: pngData(t, color.White)},
+		{name: "2.png", data: pngData(t, color.Black)},
+		{name: "ComicInfo.xml", data: comicInfoXML},
+	})
+
+	img, err := readCover(archivePath, Options{}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2.png is the black one
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("cover is the first page, want the one ComicInfo.xml marks as FrontCover")
+	}
+}
+
+func TestCoverThumbnailWaitsForLimiter(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	opts := Options{TempDir: t.TempDir(), TransformJobs: 1}.book()
+	l, err := openLibrary(filepath.Dir(archivePath), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// with every slot taken, the cover waits until its reader leaves
+	if err := opts.transforms.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.coverThumbnail(cancelled, "book.cbz"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cover with the limiter full: %v, want %v", err, context.Canceled)
+	}
+
+	opts.transforms.release()
+	if _, err := l.coverThumbnail(context.Background(), "book.cbz"); err != nil {
+		t.Errorf("cover with a free slot: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package cbzopen
+
+import (
+	"crypto/sha256"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"runtime"
+)
+
+// pageSum returns the SHA-256 of the page name in pages, or "" if it can't
+// be read, in which case it's taken as unlike any other page.
+func pageSum(pages fs.FS, name string) string {
+	f, err := pages.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer closeWithLog(f, "page")
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return ""
+	}
+
+	return string(hash.Sum(nil))
+}
+
+// omitRepeats leaves out of imageFiles each page that's byte for byte the
+// same as the one right before it, like a blank separator page scanned
+// twice, when opts asks for it. Repeats further apart are kept, since those
+// are often meant. It runs once as a book is opened, so the viewer and
+// everything else that numbers pages agree.
+func omitRepeats(pages fs.FS, imageFiles []string, opts viewerOptions) []string {
+	if !opts.dedupeConsecutive || len(imageFiles) == 0 {
+		return imageFiles
+	}
+
+	sums := make([]string, len(imageFiles))
+	_ = forEach(len(imageFiles), runtime.GOMAXPROCS(0), func(i int) error {
+		sums[i] = pageSum(pages, imageFiles[i])
+		return nil
+	})
+
+	kept := []string{imageFiles[0]}
+	for i := 1; i < len(imageFiles); i++ {
+		if sums[i] == "" || sums[i] != sums[i-1] {
+			kept = append(kept, imageFiles[i])
+		}
+	}
+
+	if omitted := len(imageFiles) - len(kept); omitted > 0 {
+		slog.Info("Left out repeated pages", "omitted", omitted)
+	}
+
+	return kept
+}
+
+// dedupePages points pages that are byte for byte the same as an earlier one
+// at that page's URL, so the browser loads and keeps one copy. sums holds
+// each page's pageSum.
+func dedupePages(pages []page, sums []string) []page {
+	first := map[string]template.URL{}
+	collapsed := 0
+	for i := range pages {
+		sum := sums[i]
+		if sum == "" {
+			continue
+		}
+
+		if url, ok := first[sum]; ok {
+			pages[i].URL = url
+			collapsed++
+		} else {
+			first[sum] = pages[i].URL
+		}
+	}
+
+	if collapsed > 0 {
+		slog.Info("Collapsed duplicate pages", "collapsed", collapsed)
+	}
+
+	return pages
+}
@@ -0,0 +1,77 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pngData returns a small PNG filled with c.
+func pngData(t *testing.T, c color.Color) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := range 4 {
+		for x := range 4 {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestDedupeConsecutive(t *testing.T) {
+	white, black := pngData(t, color.White), pngData(t, color.Black)
+	archivePath := writeZip(t, []testEntry{
+		{name: "1.png", data: white},
+		{name: "2.png", data: black},
+		{name: "3.png", data: black},
+		{name: "4.png", data: white},
+	})
+
+	for _, extract := range []bool{false, true} {
+		opts := Options{DedupeConsecutive: true, Extract: extract, TempDir: t.TempDir()}
+		b, err := openBook(context.Background(), archivePath, opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		// 3.png repeats the page before and is left out, 4.png is further
+		// from its copy and kept
+		want := []string{"1.png", "2.png", "4.png"}
+		if strings.Join(b.imageFiles, ",") != strings.Join(want, ",") {
+			t.Errorf("extract %v: pages %v, want %v", extract, b.imageFiles, want)
+		}
+
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("extract %v: viewer status %d", extract, w.Code)
+		}
+		viewerPages := strings.Count(w.Body.String(), `<img id="page-`)
+
+		w = httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pages", nil))
+		var list apiPages
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+
+		if viewerPages != len(want) || len(list.Pages) != len(want) {
+			t.Errorf("extract %v: viewer has %d pages and /api/pages %d, want %d", extract, viewerPages, len(list.Pages), len(want))
+		}
+	}
+}
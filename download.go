@@ -0,0 +1,56 @@
+package cbzopen
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+// serveDownload streams the book's pages back as a zip file, built on the
+// fly so nothing needs to be written to disk first. Pages are stored rather
+// than compressed, since images don't get any smaller.
+func (b *book) serveDownload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": b.info.Title + ".zip"}))
+
+	zipWriter := zip.NewWriter(w)
+	for _, name := range b.imageFiles {
+		if err := addToZip(zipWriter, b.pages, name); err != nil {
+			// the response has started, so all we can do is cut it short
+			slog.Error("Failed to write download", "file", name, "err", err)
+			return
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		slog.Error("Failed to write download", "err", err)
+	}
+}
+
+func addToZip(zipWriter *zip.Writer, pages fs.FS, name string) error {
+	f, err := pages.Open(name)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(f, "page")
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	entry, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, f)
+	return err
+}
@@ -0,0 +1,60 @@
+package cbzopen
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeDownload(t *testing.T) {
+	white, black := pngData(t, color.White), pngData(t, color.Black)
+	archivePath := writeZip(t, []testEntry{
+		{name: "10.png", data: black},
+		{name: "2.png", data: white},
+		{name: "notes.txt", data: "not a page"},
+		{name: "ComicInfo.xml", data: "<ComicInfo><Title>The Book</Title></ComicInfo>"},
+	})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="The Book.zip"`; got != want {
+		t.Errorf("Content-Disposition %q, want %q", got, want)
+	}
+
+	// only the pages, in reading order and as they were
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ name, data string }{{"2.png", white}, {"10.png", black}}
+	if len(zr.File) != len(want) {
+		t.Fatalf("download has %d files, want %d", len(zr.File), len(want))
+	}
+	for i, file := range zr.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		closeWithLog(f, "download entry")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Name != want[i].name || string(data) != want[i].data {
+			t.Errorf("file %d is %s with %d bytes, want %s with %d", i, file.Name, len(data), want[i].name, len(want[i].data))
+		}
+	}
+}
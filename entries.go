@@ -0,0 +1,131 @@
+package cbzopen
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+	"golang.org/x/text/encoding"
+)
+
+// entryFunc is called by walkEntries for each file in an archive with its
+// raw name, the way it's stored, the size its header gives and a way to
+// open it. open is nil for entries that aren't regular files, such as
+// links, which are never extracted. It can only be used until entryFunc
+// returns.
+type entryFunc func(name string, size int64, open func() (io.ReadCloser, error)) error
+
+// walkEntries calls fn for every file in the archive, in one pass front to
+// back. It's how whole archives are read without extracting them, for -check
+// and -in-memory; openArchiveFS is for picking out a few files, and has to
+// start over for each one in tar and solid rar archives.
+func walkEntries(archivePath string, format archiveFormat, enc encoding.Encoding, fn entryFunc) error {
+	switch format {
+	case formatZip:
+		return walkZip(archivePath, enc, fn)
+	case formatRar:
+		return walkRar(archivePath, fn)
+	case formatSevenZip:
+		return walkSevenZip(archivePath, fn)
+	case formatTar:
+		return walkTar(archivePath, fn)
+	default:
+		return errors.New("unsupported archive format")
+	}
+}
+
+func walkZip(archivePath string, enc encoding.Encoding, fn entryFunc) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(zipReader, "zipReader")
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if err := fn(zipEntryName(file, enc), int64(file.UncompressedSize64), regularOpen(file.Mode(), file.Open)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkRar reads the archive as a stream, the one way solid archives, where
+// each file is compressed together with the ones before it, can be read
+// without decompressing them again and again.
+func walkRar(archivePath string, fn entryFunc) error {
+	rarReader, err := rardecode.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(rarReader, "rarReader")
+
+	for {
+		header, err := rarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.IsDir {
+			continue
+		}
+
+		open := func() (io.ReadCloser, error) { return io.NopCloser(rarReader), nil }
+		if err := fn(header.Name, header.UnPackedSize, regularOpen(header.Mode(), open)); err != nil {
+			return err
+		}
+	}
+}
+
+func walkSevenZip(archivePath string, fn entryFunc) error {
+	sevenZipReader, err := sevenzip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(sevenZipReader, "sevenZipReader")
+
+	// the files are listed in the order they're stored in, so a solid
+	// block is decompressed once going through them
+	for _, file := range sevenZipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if err := fn(file.Name, int64(file.UncompressedSize), regularOpen(file.Mode(), file.Open)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkTar reads the archive as a stream, gzipped or not, see scanTar.
+func walkTar(archivePath string, fn entryFunc) error {
+	return scanTar(archivePath, func(header *tar.Header, r io.Reader) (bool, error) {
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return false, nil
+		case tar.TypeReg:
+			return false, fn(header.Name, header.Size, func() (io.ReadCloser, error) { return io.NopCloser(r), nil })
+		default:
+			return false, fn(header.Name, header.Size, nil)
+		}
+	})
+}
+
+// regularOpen returns open for a regular file and nil for anything else.
+func regularOpen(mode fs.FileMode, open func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	if !mode.IsRegular() {
+		return nil
+	}
+
+	return open
+}
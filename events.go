@@ -0,0 +1,105 @@
+package cbzopen
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// events sends server-sent events to the viewers connected to /events, so a
+// reloaded book can tell them to refresh.
+type events struct {
+	mu          sync.Mutex
+	subscribers map[chan string]bool
+	closed      bool
+}
+
+func newEvents() *events {
+	return &events{subscribers: map[chan string]bool{}}
+}
+
+func (e *events) subscribe() (chan string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil, false
+	}
+
+	// buffered so a slow client doesn't hold up send; one pending reload is
+	// as good as several
+	ch := make(chan string, 1)
+	e.subscribers[ch] = true
+
+	return ch, true
+}
+
+func (e *events) unsubscribe(ch chan string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.subscribers, ch)
+}
+
+// send delivers event to every subscriber that doesn't already have one
+// waiting.
+func (e *events) send(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close disconnects every subscriber, so their requests end and don't hold
+// up shutting down the server.
+func (e *events) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for ch := range e.subscribers {
+		close(ch)
+	}
+	e.subscribers = map[chan string]bool{}
+	e.closed = true
+}
+
+func (e *events) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, ok := e.subscribe()
+	if !ok {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer e.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata:\n\n", event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package cbzopen
+
+import (
+	"bufio"
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadEvent(t *testing.T) {
+	page := pngData(t, color.White)
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: page}})
+	s, err := NewServer(context.Background(), archivePath, Options{TempDir: t.TempDir(), Watch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeWithLog(resp.Body, "events")
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type %q, want text/event-stream", got)
+	}
+
+	// the book gets a second page
+	data, err := os.ReadFile(writeZip(t, []testEntry{{name: "1.png", data: page}, {name: "2.png", data: page}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archivePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("waiting for an event: %v", err)
+	}
+	if line != "event: reload\n" {
+		t.Errorf("got %q, want a reload event", line)
+	}
+	if got := s.PageCount(); got != 2 {
+		t.Errorf("%d pages after reloading, want 2", got)
+	}
+
+	// a viewer going away unsubscribes it
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for subscribers(s.events) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := subscribers(s.events); n > 0 {
+		t.Errorf("%d subscribers left after disconnecting", n)
+	}
+}
+
+// subscribers returns how many viewers e has.
+func subscribers(e *events) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.subscribers)
+}
+
+func TestEventsClosed(t *testing.T) {
+	e := newEvents()
+	e.close()
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "shutting down") {
+		t.Errorf("status %d with %q, want %d", w.Code, w.Body.String(), http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,195 @@
+package cbzopen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 if it
+// doesn't carry one.
+func jpegOrientation(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return 0, err
+	}
+	if soi != [2]byte{0xff, 0xd8} {
+		return 0, errors.New("not a jpeg")
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return 0, err
+		}
+		if marker[0] != 0xff {
+			return 0, errors.New("invalid jpeg marker")
+		}
+
+		// start of scan or end of image, there's no metadata past this point
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return 1, nil
+		}
+
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return 0, errors.New("invalid jpeg segment size")
+		}
+
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return 0, err
+		}
+
+		// APP1 holds the EXIF data
+		if marker[1] == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag out of IFD0 of a TIFF structure.
+func exifOrientation(tiff []byte) (int, error) {
+	if len(tiff) < 8 {
+		return 0, errors.New("short exif data")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, errors.New("invalid exif byte order")
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 0, errors.New("invalid exif ifd offset")
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := range count {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1, nil
+			}
+			return orientation, nil
+		}
+	}
+
+	return 1, nil
+}
+
+// orient applies the rotation/flip described by an EXIF orientation so that
+// the result displays upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// orientations 5 to 8 rotate by 90 degrees, swapping width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
+
+// autoRotate rewrites a JPEG upright according to its EXIF orientation.
+// Files without an orientation tag are left untouched.
+func autoRotate(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	orientation, err := jpegOrientation(bytes.NewReader(data))
+	if err != nil || orientation == 1 {
+		// not something we can rotate, leave it for the browser
+		return nil
+	}
+
+	img, _, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	// re-encoding drops the EXIF data, so the browser won't rotate it again
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(img, orientation), &jpeg.Options{Quality: 90}); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// autoRotateDir applies autoRotate to every JPEG in dir and its subfolders.
+func autoRotateDir(dir string) error {
+	names, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".jpg" && ext != ".jpeg" {
+			continue
+		}
+
+		if err := autoRotate(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
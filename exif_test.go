@@ -0,0 +1,88 @@
+package cbzopen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exifJPEG encodes a 16x8 JPEG, black on the left half and white on the
+// right, tagged with the EXIF orientation.
+func exifJPEG(t *testing.T, orientation int) []byte {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for y := range 8 {
+		for x := 8; x < 16; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a big endian TIFF header and an IFD0 holding just the orientation
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	for _, v := range []any{uint32(8), uint16(1), uint16(exifOrientationTag), uint16(3), uint32(1), uint16(orientation), uint16(0), uint32(0)} {
+		_ = binary.Write(&tiff, binary.BigEndian, v)
+	}
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	data := []byte{0xff, 0xd8, 0xff, 0xe1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(app1)+2))
+	data = append(data, app1...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+func TestAutoRotate(t *testing.T) {
+	tests := []struct {
+		orientation   int
+		width, height int
+		// black is a point that's black once the page is upright
+		black image.Point
+	}{
+		{orientation: 1, width: 16, height: 8, black: image.Pt(2, 4)},
+		{orientation: 3, width: 16, height: 8, black: image.Pt(13, 4)},
+		{orientation: 6, width: 8, height: 16, black: image.Pt(4, 2)},
+		{orientation: 8, width: 8, height: 16, black: image.Pt(4, 13)},
+	}
+
+	for _, tt := range tests {
+		data := exifJPEG(t, tt.orientation)
+		if got, err := jpegOrientation(bytes.NewReader(data)); err != nil || got != tt.orientation {
+			t.Fatalf("jpegOrientation = %d, %v, want %d", got, err, tt.orientation)
+		}
+
+		path := filepath.Join(t.TempDir(), "page.jpg")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := autoRotate(path); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := jpeg.Decode(f)
+		closeWithLog(f, "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bounds := img.Bounds(); bounds.Dx() != tt.width || bounds.Dy() != tt.height {
+			t.Errorf("orientation %d: page is %dx%d, want %dx%d", tt.orientation, bounds.Dx(), bounds.Dy(), tt.width, tt.height)
+		}
+		if y := color.GrayModel.Convert(img.At(tt.black.X, tt.black.Y)).(color.Gray).Y; y > 64 {
+			t.Errorf("orientation %d: %v is %d, want black", tt.orientation, tt.black, y)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cbzopen
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"path"
+)
+
+// largeExport is the size of the pages past which Export warns that the
+// file will be slow to open. Base64 makes it a third bigger again.
+const largeExport = 100 * MiB
+
+// Export writes the viewer for the archive or image directory at path to w
+// as a single HTML file with the pages in it, which opens anywhere without
+// a server or the images next to it.
+func Export(ctx context.Context, path string, w io.Writer, opts Options) error {
+	return writeStaticIndex(ctx, path, w, opts, true)
+}
+
+// dataURL returns the page name in pagesFS as a data: URL.
+func dataURL(pagesFS fs.FS, name string) (template.URL, error) {
+	data, err := fs.ReadFile(pagesFS, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read page: %w", err)
+	}
+
+	mediaType, ok := sniffHeader(data[:min(len(data), sniffLen)])
+	if !ok {
+		mediaType = mime.TypeByExtension(path.Ext(name))
+	}
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	return template.URL("data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// warnLargeExport warns if the pages add up to more than largeExport, since
+// browsers hold the whole file in memory and take a while to parse it.
+func warnLargeExport(pagesFS fs.FS, imageFiles []string) {
+	var total ByteSize
+	for _, name := range imageFiles {
+		if info, err := fs.Stat(pagesFS, name); err == nil {
+			total += ByteSize(info.Size())
+		}
+	}
+
+	if total > largeExport {
+		slog.Warn("The exported file will be large and may be slow to open", "size", total.Approx())
+	}
+}
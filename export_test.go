@@ -0,0 +1,47 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/color"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	white, black := pngData(t, color.White), pngData(t, color.Black)
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: white}, {name: "a b.png", data: black}})
+
+	var out bytes.Buffer
+	if err := Export(context.Background(), archivePath, &out, Options{TempDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	index := out.String()
+
+	for _, want := range []string{
+		`<img id="page-1" src="data:image/png;base64,` + base64.StdEncoding.EncodeToString([]byte(white)) + `"`,
+		`<img id="page-2" src="data:image/png;base64,` + base64.StdEncoding.EncodeToString([]byte(black)) + `"`,
+		// nothing that needs a server is tried
+		`data-static="true"`,
+		`data-inline="true"`,
+		`data-watch="false"`,
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("export doesn't contain %.80s", want)
+		}
+	}
+
+	// it opens on its own, with nothing loaded from next to it
+	for _, notWant := range []string{`<link rel="stylesheet"`, "<script src=", `<link rel="manifest"`} {
+		if strings.Contains(index, notWant) {
+			t.Errorf("export contains %s", notWant)
+		}
+	}
+	for _, src := range regexp.MustCompile(`(?:src|href)="([^"]*)"`).FindAllStringSubmatch(index, -1) {
+		if !strings.HasPrefix(src[1], "data:") && !strings.HasPrefix(src[1], "#") {
+			t.Errorf("export refers to %s", src[1])
+		}
+	}
+}
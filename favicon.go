@@ -0,0 +1,19 @@
+package cbzopen
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+	"time"
+)
+
+//go:embed favicon.ico
+var favicon []byte
+
+// serveFavicon answers the /favicon.ico browsers ask for on their own, so it
+// doesn't show up as a 404 for every book.
+func serveFavicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	http.ServeContent(w, r, "favicon.ico", time.Time{}, bytes.NewReader(favicon))
+}
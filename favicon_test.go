@@ -0,0 +1,68 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeFavicon(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	book, err := NewServer(context.Background(), archivePath, Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+	library, err := NewServer(context.Background(), writeLibrary(t, "a.cbz"), Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	for name, s := range map[string]*Server{"book": book, "library": library} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/x-icon" {
+			t.Errorf("%s: status %d with Content-Type %q, want %d with image/x-icon", name, w.Code, w.Header().Get("Content-Type"), http.StatusOK)
+		}
+		// an ICO file starts with a reserved zero and its type, 1
+		if !bytes.HasPrefix(w.Body.Bytes(), []byte{0, 0, 1, 0}) {
+			t.Errorf("%s: favicon starts with %q, want an ICO header", name, w.Body.Bytes()[:min(4, w.Body.Len())])
+		}
+	}
+}
+
+func TestIndexTitle(t *testing.T) {
+	page := pngData(t, color.White)
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		want    string
+	}{
+		{name: "file name", entries: []testEntry{{name: "1.png", data: page}}, want: "<title>book</title>"},
+		{
+			name:    "ComicInfo.xml",
+			entries: []testEntry{{name: "1.png", data: page}, {name: "ComicInfo.xml", data: "<ComicInfo><Title>Tom &amp; Jerry</Title></ComicInfo>"}},
+			want:    "<title>Tom &amp; Jerry</title>",
+		},
+	}
+
+	for _, tt := range tests {
+		b, err := openBook(context.Background(), writeZip(t, tt.entries), Options{TempDir: t.TempDir()}.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: index doesn't contain %s", tt.name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cbzopen
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// notFoundHTML is the 404 page for files missing from a book, with a link
+// back to the book.
+const notFoundHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Not found</title>
+    <style>
+        body {
+            background-color: #222;
+            color: #ddd;
+            font-family: sans-serif;
+            text-align: center;
+            padding: 40px 20px;
+        }
+
+        a {
+            color: #ddd;
+        }
+    </style>
+</head>
+<body>
+<h1>Not found</h1>
+<p>This book has no such page.</p>
+<p><a href="%s">Back to the book</a></p>
+</body>
+</html>
+`
+
+// notFound answers with notFoundHTML, linking back to the book r is for.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = fmt.Fprintf(w, notFoundHTML, html.EscapeString(basePath(r)+"/"))
+}
+
+// serveFiles serves the pages in known, and the viewer at index.html, from
+// pages like http.FileServerFS. Everything else is not found, the same as a
+// missing file, whatever fs.FS the book is read from: other files the
+// archive or folder has, like dotfiles or notes, and folders, whose listings
+// would only show how the archive or the temp dir is laid out.
+func serveFiles(pages fs.FS, known map[string]bool) http.Handler {
+	files := http.FileServerFS(pages)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name != "" && name != "index.html" && !known[name] {
+			notFound(w, r)
+			return
+		}
+
+		fileInfo, err := fs.Stat(pages, cmp.Or(name, "index.html"))
+		if err != nil || fileInfo.IsDir() {
+			notFound(w, r)
+			return
+		}
+
+		files.ServeHTTP(w, r)
+	})
+}
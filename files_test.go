@@ -0,0 +1,60 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeFilesNotFound(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{
+		{name: "ch1/1.png", data: pngData(t, color.White)},
+		{name: "notes.txt", data: "not a page"},
+	})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/ch1/1.png", want: http.StatusOK},
+		{path: "/", want: http.StatusOK},
+		{path: "/ch1/", want: http.StatusNotFound},
+		{path: "/ch1", want: http.StatusNotFound},
+		{path: "/missing.png", want: http.StatusNotFound},
+		{path: "/notes.txt", want: http.StatusNotFound},
+	}
+
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{"in place", Options{}},
+		{"in memory", Options{InMemory: true, PreserveStructure: true}},
+		{"extracted", Options{Extract: true, PreserveStructure: true}},
+	}
+
+	for _, mode := range modes {
+		mode.opts.TempDir = t.TempDir()
+		b, err := openBook(context.Background(), archivePath, mode.opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("%s: %s: status %d, want %d", mode.name, tt.path, w.Code, tt.want)
+			}
+			// the 404 page is ours, with a way back, not a listing or Go's
+			// plain text one
+			if tt.want == http.StatusNotFound && !strings.Contains(w.Body.String(), "Back to the book") {
+				t.Errorf("%s: %s: body %q, want the custom 404 page", mode.name, tt.path, w.Body.String())
+			}
+		}
+	}
+}
@@ -1,3 +1,29 @@
 module cbzopen
 
 go 1.24.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/bodgit/sevenzip v1.6.1
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/gen2brain/avif v0.4.4
+	github.com/gen2brain/jpegxl v0.4.5
+	github.com/nwaples/rardecode/v2 v2.4.1
+	golang.org/x/image v0.36.0
+	golang.org/x/text v0.34.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.2.2 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/ebitengine/purego v0.10.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/compress v1.19.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.27 // indirect
+	github.com/spf13/afero v1.15.0 // indirect
+	github.com/tetratelabs/wazero v1.11.0 // indirect
+	github.com/ulikunitz/xz v0.5.15 // indirect
+	go4.org v0.0.0-20260112195520-a5071408f32f // indirect
+	golang.org/x/sys v0.41.0 // indirect
+)
@@ -0,0 +1,249 @@
+package cbzopen
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// Languages are the languages the viewer can be shown in, see
+// Options.Language. The first is the fallback.
+var Languages = []string{"en", "ja", "es"}
+
+var languageMatcher = language.NewMatcher([]language.Tag{language.English, language.Japanese, language.Spanish})
+
+// uiStrings are the viewer's words in one language. Page has a %d for the
+// page number. Key names like "Page Down" stay as they're printed on the
+// keyboard.
+type uiStrings struct {
+	NoPages           string
+	Pages             string
+	Info              string
+	Filter            string
+	Grayscale         string
+	Sepia             string
+	Invert            string
+	Bookmarks         string
+	Keys              string
+	SavePage          string
+	DownloadAll       string
+	PreviousBook      string
+	NextBook          string
+	KeyboardShortcuts string
+	BookmarkPage      string
+	Page              string
+	Remove            string
+
+	// the actions in the "?" overlay, see shortcuts
+	NextPage          string
+	PreviousPage      string
+	FirstLastPage     string
+	FitWidthHeight    string
+	TwoPages          string
+	CoverAlone        string
+	PageAloneOrPaired string
+	Zoom              string
+	ResetZoom         string
+	Rotate            string
+	CycleFilters      string
+	Slideshow         string
+	ToggleThumbnails  string
+	ToggleInfo        string
+	ToggleBookmark    string
+	ToggleBookmarks   string
+	PreviousNextBook  string
+	ToggleHelp        string
+	ClosePanel        string
+}
+
+var translations = map[string]uiStrings{
+	"en": {
+		NoPages:           "No pages found.",
+		Pages:             "Pages",
+		Info:              "Info",
+		Filter:            "Filter",
+		Grayscale:         "grayscale",
+		Sepia:             "sepia",
+		Invert:            "invert",
+		Bookmarks:         "Bookmarks",
+		Keys:              "Keys",
+		SavePage:          "Save page",
+		DownloadAll:       "Download all",
+		PreviousBook:      "Previous book",
+		NextBook:          "Next book",
+		KeyboardShortcuts: "Keyboard shortcuts",
+		BookmarkPage:      "Bookmark this page",
+		Page:              "Page %d",
+		Remove:            "Remove",
+
+		NextPage:          "Next page",
+		PreviousPage:      "Previous page",
+		FirstLastPage:     "First / last page",
+		FitWidthHeight:    "Fit page to width / height",
+		TwoPages:          "Show two pages side by side",
+		CoverAlone:        "Show the cover on its own",
+		PageAloneOrPaired: "Show the current page alone or paired",
+		Zoom:              "Zoom in / out",
+		ResetZoom:         "Reset the zoom",
+		Rotate:            "Rotate the page left / right",
+		CycleFilters:      "Cycle through the filters",
+		Slideshow:         "Play / pause the slideshow",
+		ToggleThumbnails:  "Show / hide the thumbnails",
+		ToggleInfo:        "Show / hide the book info",
+		ToggleBookmark:    "Bookmark the page, or remove its bookmark",
+		ToggleBookmarks:   "Show / hide the bookmarks",
+		PreviousNextBook:  "Previous / next book",
+		ToggleHelp:        "Show / hide this list",
+		ClosePanel:        "Close the open panel",
+	},
+	"ja": {
+		NoPages:           "ページが見つかりません。",
+		Pages:             "ページ一覧",
+		Info:              "情報",
+		Filter:            "フィルター",
+		Grayscale:         "グレースケール",
+		Sepia:             "セピア",
+		Invert:            "反転",
+		Bookmarks:         "ブックマーク",
+		Keys:              "キー操作",
+		SavePage:          "ページを保存",
+		DownloadAll:       "すべてダウンロード",
+		PreviousBook:      "前の本",
+		NextBook:          "次の本",
+		KeyboardShortcuts: "キーボードショートカット",
+		BookmarkPage:      "このページをブックマーク",
+		Page:              "%dページ",
+		Remove:            "削除",
+
+		NextPage:          "次のページ",
+		PreviousPage:      "前のページ",
+		FirstLastPage:     "最初 / 最後のページ",
+		FitWidthHeight:    "幅 / 高さに合わせる",
+		TwoPages:          "見開きで表示",
+		CoverAlone:        "表紙を単独で表示",
+		PageAloneOrPaired: "今のページを単独 / 見開きで表示",
+		Zoom:              "拡大 / 縮小",
+		ResetZoom:         "ズームをリセット",
+		Rotate:            "ページを左 / 右に回転",
+		CycleFilters:      "フィルターを切り替え",
+		Slideshow:         "スライドショーを再生 / 一時停止",
+		ToggleThumbnails:  "サムネイルを表示 / 非表示",
+		ToggleInfo:        "本の情報を表示 / 非表示",
+		ToggleBookmark:    "ページをブックマーク、またはブックマークを削除",
+		ToggleBookmarks:   "ブックマークを表示 / 非表示",
+		PreviousNextBook:  "前 / 次の本",
+		ToggleHelp:        "この一覧を表示 / 非表示",
+		ClosePanel:        "開いているパネルを閉じる",
+	},
+	"es": {
+		NoPages:           "No se encontraron páginas.",
+		Pages:             "Páginas",
+		Info:              "Información",
+		Filter:            "Filtro",
+		Grayscale:         "escala de grises",
+		Sepia:             "sepia",
+		Invert:            "invertido",
+		Bookmarks:         "Marcadores",
+		Keys:              "Teclas",
+		SavePage:          "Guardar página",
+		DownloadAll:       "Descargar todo",
+		PreviousBook:      "Libro anterior",
+		NextBook:          "Libro siguiente",
+		KeyboardShortcuts: "Atajos de teclado",
+		BookmarkPage:      "Marcar esta página",
+		Page:              "Página %d",
+		Remove:            "Quitar",
+
+		NextPage:          "Página siguiente",
+		PreviousPage:      "Página anterior",
+		FirstLastPage:     "Primera / última página",
+		FitWidthHeight:    "Ajustar la página al ancho / alto",
+		TwoPages:          "Mostrar dos páginas juntas",
+		CoverAlone:        "Mostrar la portada sola",
+		PageAloneOrPaired: "Mostrar la página actual sola o emparejada",
+		Zoom:              "Acercar / alejar",
+		ResetZoom:         "Restablecer el zoom",
+		Rotate:            "Girar la página a la izquierda / derecha",
+		CycleFilters:      "Cambiar de filtro",
+		Slideshow:         "Reproducir / pausar la presentación",
+		ToggleThumbnails:  "Mostrar / ocultar las miniaturas",
+		ToggleInfo:        "Mostrar / ocultar la información del libro",
+		ToggleBookmark:    "Marcar la página o quitar su marcador",
+		ToggleBookmarks:   "Mostrar / ocultar los marcadores",
+		PreviousNextBook:  "Libro anterior / siguiente",
+		ToggleHelp:        "Mostrar / ocultar esta lista",
+		ClosePanel:        "Cerrar el panel abierto",
+	},
+}
+
+// preferredLanguage picks the language to show the viewer in for an
+// Accept-Language header, English if the reader wants none of Languages.
+func preferredLanguage(acceptLanguage string) string {
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, i, confidence := languageMatcher.Match(tags...)
+	if confidence == language.No {
+		return Languages[0]
+	}
+
+	return Languages[i]
+}
+
+// localizedIndex serves the viewer in the reader's language, going by
+// Accept-Language, for books opened without a fixed one. index.html is
+// written in English, so the other languages are written the first time
+// they're asked for and kept.
+type localizedIndex struct {
+	book    *book
+	viewer  viewerOptions
+	indexes sync.Map
+}
+
+func (l *localizedIndex) serve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name != "" && name != "index.html" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Language")
+		lang := preferredLanguage(r.Header.Get("Accept-Language"))
+		if lang == Languages[0] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		index, err := l.index(lang)
+		if err != nil {
+			slog.Error("Failed to create index.html", "lang", lang, "err", err)
+			http.Error(w, "Failed to create index.html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(index)
+	})
+}
+
+func (l *localizedIndex) index(lang string) ([]byte, error) {
+	if index, ok := l.indexes.Load(lang); ok {
+		return index.([]byte), nil
+	}
+
+	viewer := l.viewer
+	viewer.language = lang
+
+	var index bytes.Buffer
+	b := l.book
+	if err := writeIndexHTML(&index, b.pages, b.imageFiles, b.info, viewer); err != nil {
+		return nil, err
+	}
+
+	stored, _ := l.indexes.LoadOrStore(lang, index.Bytes())
+	return stored.([]byte), nil
+}
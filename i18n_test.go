@@ -0,0 +1,86 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{acceptLanguage: "", want: "en"},
+		{acceptLanguage: "ja", want: "ja"},
+		{acceptLanguage: "ja-JP,ja;q=0.9,en;q=0.8", want: "ja"},
+		{acceptLanguage: "es-MX", want: "es"},
+		{acceptLanguage: "fr,es;q=0.5", want: "es"},
+		// none we have falls back to English
+		{acceptLanguage: "fr-FR", want: "en"},
+		{acceptLanguage: "not a header", want: "en"},
+	}
+
+	for _, tt := range tests {
+		if got := preferredLanguage(tt.acceptLanguage); got != tt.want {
+			t.Errorf("%q: %s, want %s", tt.acceptLanguage, got, tt.want)
+		}
+	}
+}
+
+func TestIndexLanguage(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{
+			name:    "english",
+			want:    []string{`<html lang="en">`, `<button class="help-toggle" type="button">Keys</button>`, "<h1>Keyboard shortcuts</h1>"},
+			notWant: []string{"キー操作"},
+		},
+		{
+			name:    "japanese",
+			opts:    viewerOptions{language: "ja"},
+			want:    []string{`<html lang="ja">`, `<button class="help-toggle" type="button">キー操作</button>`, "<h1>キーボードショートカット</h1>", "<dd>次のページ</dd>"},
+			notWant: []string{"Keyboard shortcuts"},
+		},
+	})
+}
+
+func TestServeLocalizedIndex(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+
+	tests := []struct {
+		name           string
+		language       string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "browser's language", acceptLanguage: "ja-JP,en;q=0.5", want: `<html lang="ja">`},
+		{name: "browser's other language", acceptLanguage: "es", want: `<html lang="es">`},
+		{name: "no header", want: `<html lang="en">`},
+		// -lang wins over what the browser asks for
+		{name: "fixed language", language: "ja", acceptLanguage: "es", want: `<html lang="ja">`},
+	}
+
+	for _, tt := range tests {
+		b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir(), Language: tt.language}.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, want %d", tt.name, w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: index doesn't contain %s", tt.name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cbzopen
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// imageDirFS serves the pages of a directory of images and an in-memory
+// index.html, so it can be viewed without writing anything into it. Only
+// the pages can be opened: other files in the folder, its subfolders and
+// anything that isn't a regular file, like a link pointing out of it, are
+// reported as missing.
+type imageDirFS struct {
+	dir     string
+	pages   map[string]bool
+	index   []byte
+	created time.Time
+}
+
+func newImageDirFS(dir string, pages []string, index []byte) *imageDirFS {
+	d := &imageDirFS{dir: dir, pages: make(map[string]bool, len(pages)), index: index, created: time.Now()}
+	for _, name := range pages {
+		d.pages[name] = true
+	}
+
+	return d
+}
+
+func (d *imageDirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	switch {
+	case name == "index.html" && d.index != nil:
+		return newMemFile(name, d.index, d.created), nil
+	case name == ".":
+		return &memDir{info: memFileInfo{name: ".", modTime: d.created, dir: true}}, nil
+	case !d.pages[name]:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// checked again on every open, in case a page was swapped for a link
+	// since the folder was listed
+	path := filepath.Join(d.dir, filepath.FromSlash(name))
+	if fileInfo, err := os.Lstat(path); err != nil || !fileInfo.Mode().IsRegular() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return os.Open(path)
+}
+
+// openImageDir serves a directory of loose images in place, as if it were
+// an extracted archive.
+func (b *book) openImageDir(opts bookOptions) error {
+	names, err := topLevelFiles(b.path)
+	if err != nil {
+		return err
+	}
+
+	dirFS := os.DirFS(b.path)
+	b.info = readComicInfo(dirFS, b.path)
+	b.imageFiles = omitRepeats(dirFS, orderPages(imagePagesFS(dirFS, names, opts.extensions, opts.order), b.info), opts.viewer)
+
+	var index bytes.Buffer
+	if err := writeIndexHTML(&index, dirFS, b.imageFiles, b.info, opts.viewer); err != nil {
+		return fmt.Errorf("failed to create index.html: %w", err)
+	}
+
+	b.pages = newImageDirFS(b.path, b.imageFiles, index.Bytes())
+
+	return nil
+}
+
+// topLevelFiles returns the names of the regular files directly in dir,
+// leaving out its folders and what's in them, and links.
+func topLevelFiles(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.Type().IsRegular() {
+			names = append(names, file.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// hasPages reports whether dir directly contains any pages.
+func hasPages(dir string, exts []string) bool {
+	names, err := topLevelFiles(dir)
+	if err != nil {
+		return false
+	}
+
+	dirFS := os.DirFS(dir)
+	return slices.ContainsFunc(names, func(name string) bool { return isPage(dirFS, name, exts) })
+}
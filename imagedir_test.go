@@ -0,0 +1,73 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestImageDir(t *testing.T) {
+	page := pngData(t, color.White)
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"10.png":    page,
+		"2.png":     page,
+		"notes.txt": "not a page",
+		"sub/3.png": page,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(t.TempDir(), "secret.png")
+	if err := os.WriteFile(outside, []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.png")); err != nil {
+		t.Skip("can't make links here:", err)
+	}
+
+	b, err := openBook(context.Background(), dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if want := []string{"2.png", "10.png"}; !slices.Equal(b.imageFiles, want) {
+		t.Errorf("pages %q, want %q", b.imageFiles, want)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/", want: http.StatusOK},
+		{path: "/2.png", want: http.StatusOK},
+		{path: "/10.png", want: http.StatusOK},
+		{path: "/notes.txt", want: http.StatusNotFound},
+		{path: "/sub/3.png", want: http.StatusNotFound},
+		{path: "/link.png", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+
+	// the viewer is kept in memory, the user's folder is left as it was
+	if _, err := os.Stat(filepath.Join(dir, "index.html")); !os.IsNotExist(err) {
+		t.Errorf("index.html written to the image directory: %v", err)
+	}
+}
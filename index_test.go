@@ -0,0 +1,346 @@
+package cbzopen
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// renderIndex writes the viewer for a three page book with opts and returns
+// it.
+func renderIndex(t *testing.T, opts viewerOptions) string {
+	t.Helper()
+
+	page := []byte(pngData(t, color.White))
+	pages := fstest.MapFS{"1.png": {Data: page}, "2.png": {Data: page}, "3.png": {Data: page}}
+
+	var index bytes.Buffer
+	if err := writeIndexHTML(&index, pages, []string{"1.png", "2.png", "3.png"}, comicInfo{Title: "Book"}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	return index.String()
+}
+
+// checkIndex renders the viewer for each of tests and checks it contains
+// everything in want and nothing in notWant.
+func checkIndex(t *testing.T, tests []indexTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		index := renderIndex(t, tt.opts)
+		for _, want := range tt.want {
+			if !strings.Contains(index, want) {
+				t.Errorf("%s: index doesn't contain %s", tt.name, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(index, notWant) {
+				t.Errorf("%s: index contains %s", tt.name, notWant)
+			}
+		}
+	}
+}
+
+type indexTest struct {
+	name    string
+	opts    viewerOptions
+	want    []string
+	notWant []string
+}
+
+func TestIndexDirection(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{
+			name: "left to right",
+			want: []string{`data-direction="ltr"`, `<div class="image-container" dir="ltr">`},
+		},
+		{
+			name: "right to left",
+			opts: viewerOptions{RTL: true},
+			want: []string{`data-direction="rtl"`, `<div class="image-container" dir="rtl">`},
+		},
+	})
+}
+
+func TestIndexSpread(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "single pages", want: []string{`data-spread="false"`}},
+		{name: "spread", opts: viewerOptions{Spread: true}, want: []string{`data-spread="true"`}},
+	})
+}
+
+func TestIndexCover(t *testing.T) {
+	// spreads start with the cover alone unless it's paired; the groups are
+	// built the same way either way the book reads, and dir puts them in
+	// order
+	grouping := []string{"function isCoverAlone()", "|| (i === 0 && isCoverAlone())"}
+	checkIndex(t, []indexTest{
+		{name: "cover alone", opts: viewerOptions{Spread: true}, want: slices.Concat(grouping, []string{`data-spread="true" data-cover="true"`})},
+		{name: "cover paired", opts: viewerOptions{Spread: true, CoverPaired: true}, want: slices.Concat(grouping, []string{`data-spread="true" data-cover="false"`})},
+		{name: "right to left", opts: viewerOptions{Spread: true, CoverPaired: true, RTL: true}, want: slices.Concat(grouping, []string{`data-cover="false"`, `<div class="image-container" dir="rtl">`})},
+	})
+}
+
+func TestIndexScroll(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "paged", want: []string{`data-mode="paged"`}},
+		{name: "scroll", opts: viewerOptions{Scroll: true}, want: []string{`data-mode="scroll"`}},
+	})
+}
+
+func TestIndexPageAnchors(t *testing.T) {
+	// every page has an anchor to jump to, and the counter and the
+	// shortcuts are there to show where the reader is and how to move
+	checkIndex(t, []indexTest{{
+		name: "anchors",
+		want: []string{
+			`<img id="page-1" src="1.png"`,
+			`<img id="page-2" src="2.png"`,
+			`<img id="page-3" src="3.png"`,
+			`<div class="page-counter"></div>`,
+			`<dt><kbd>→</kbd><kbd>Page Down</kbd><kbd>Space</kbd></dt>`,
+		},
+	}})
+}
+
+func TestIndexThumbnailGrid(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "served", want: []string{`<a href="#page-2"><img src="thumbs/2.png" alt="2.png" loading="lazy">2</a>`}},
+		// without a server, the grid shows the pages themselves
+		{name: "static", opts: viewerOptions{Static: true}, want: []string{`<a href="#page-2"><img src="2.png" alt="2.png" loading="lazy">2</a>`}, notWant: []string{`src="thumbs/`}},
+	})
+}
+
+func TestIndexTouch(t *testing.T) {
+	// taps and swipes turn the page, the way the book reads; pinching is
+	// left to the browser
+	checkIndex(t, []indexTest{
+		{
+			name: "left to right",
+			want: []string{"function setupTouch()", `document.addEventListener("touchend"`, "setupTouch();", "touch-action: pan-x pan-y;", `data-direction="ltr"`},
+		},
+		{
+			name: "right to left",
+			opts: viewerOptions{RTL: true},
+			want: []string{"function setupTouch()", "if (isRTL()) {", `data-direction="rtl"`},
+		},
+	})
+}
+
+func TestIndexSlideshow(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "off", want: []string{`data-slideshow="0"`, `data-loop="false"`}},
+		{name: "every 5 seconds", opts: viewerOptions{Slideshow: 5}, want: []string{`data-slideshow="5"`, `data-loop="false"`, "function playSlideshow()"}},
+		{name: "looping", opts: viewerOptions{Slideshow: 3, Loop: true}, want: []string{`data-slideshow="3"`, `data-loop="true"`}},
+	})
+}
+
+func TestIndexPreload(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "none", want: []string{`data-preload="0"`}},
+		{name: "two either side", opts: viewerOptions{Preload: 2}, want: []string{`data-preload="2"`, "function preloadAround(group)", "Math.max(group[0] - preload, 0)", "pages.length - 1)"}},
+	})
+}
+
+func TestIndexSettingsSaved(t *testing.T) {
+	// the fit, spread and cover choices are kept per book, by the title
+	// shown in the info overlay
+	checkIndex(t, []indexTest{{
+		name: "settings",
+		want: []string{
+			"<div class=\"overlay info\" hidden>\n    <h1>Book</h1>",
+			`const settingsKey = "cbzopen:" + document.querySelector(".info h1").textContent;`,
+			`const savedSettings = ["fit", "spread", "cover"];`,
+			"localStorage.setItem(settingsKey, JSON.stringify(settings));",
+			"loadSettings();",
+		},
+	}})
+}
+
+func TestIndexZoom(t *testing.T) {
+	zoom := []string{
+		"function setupZoom()",
+		`container.addEventListener("wheel"`,
+		`container.addEventListener("mousedown"`,
+		"case \"+\":",
+		"case \"0\":\n                    resetZoom();",
+	}
+	checkIndex(t, []indexTest{
+		// turning the page resets the zoom unless it's kept
+		{name: "reset on page turn", want: slices.Concat(zoom, []string{`data-keep-zoom="false"`})},
+		{name: "kept on page turn", opts: viewerOptions{KeepZoom: true}, want: slices.Concat(zoom, []string{`data-keep-zoom="true"`})},
+	})
+}
+
+func TestIndexFilters(t *testing.T) {
+	// the filters style every page, so they work in spread and scroll mode
+	// as well
+	filters := []string{
+		`<button class="filter-toggle" type="button" data-label="Filter" data-grayscale="grayscale" data-sepia="sepia" data-invert="invert">Filter</button>`,
+		`body[data-filter="grayscale"] img {`,
+		`body[data-filter="sepia"] img {`,
+		`body[data-filter="invert"] img {`,
+		`const storageKey = "cbzopen:filter";`,
+		`if (event.key !== "f"`,
+	}
+	checkIndex(t, []indexTest{
+		{name: "paged", want: filters},
+		{name: "spread", opts: viewerOptions{Spread: true}, want: filters},
+		{name: "scroll", opts: viewerOptions{Scroll: true}, want: filters},
+	})
+}
+
+func TestIndexLayout(t *testing.T) {
+	// pages are centered on a dark background and fit the window, with
+	// nothing loaded from elsewhere
+	checkIndex(t, []indexTest{{
+		name: "layout",
+		want: []string{
+			`<meta name="viewport" content="width=device-width, initial-scale=1.0">`,
+			"background-color: #222;",
+			"text-align: center;",
+			"@media (max-width: 600px) {",
+			`body[data-fit=""] .paged img.current {`,
+			"max-height: calc(100dvh - 3 * var(--gap));",
+			`<div class="image-container" dir="ltr">`,
+		},
+		notWant: []string{`<link rel="stylesheet"`, "<script src="},
+	}})
+}
+
+func TestIndexLazyLoading(t *testing.T) {
+	// every page is lazy loaded; paged mode loads those around the shown
+	// ones and drops the images of those far from it
+	checkIndex(t, []indexTest{{
+		name: "lazy",
+		opts: viewerOptions{Preload: 2},
+		want: []string{
+			`<img id="page-1" src="1.png" alt="1.png" width="4" height="4" data-width="4" data-height="4" loading="lazy">`,
+			`<img id="page-3" src="3.png" alt="3.png" width="4" height="4" data-width="4" data-height="4" loading="lazy">`,
+			"const unloadDistance = preload + 4;",
+			`page.removeAttribute("src");`,
+			"page.src = page.dataset.src;",
+		},
+	}})
+}
+
+func TestIndexWatch(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "not watched", want: []string{`data-watch="false"`}},
+		{name: "watched", opts: viewerOptions{Watch: true}, want: []string{`data-watch="true"`, `new EventSource("events").addEventListener("reload"`}},
+	})
+}
+
+func TestIndexRotation(t *testing.T) {
+	// [ and ] turn the shown page a quarter, and the turn is kept per page
+	// of the book
+	checkIndex(t, []indexTest{{
+		name: "rotation",
+		want: []string{
+			"case \"[\":\n                    rotate(-90);",
+			"case \"]\":\n                    rotate(90);",
+			`const rotationsKey = settingsKey + ":rotations";`,
+			"localStorage.setItem(rotationsKey, JSON.stringify(rotations));",
+			`page.style.transform = degrees ? "rotate(" + degrees + "deg)" : "";`,
+		},
+	}})
+}
+
+func TestIndexPageSizes(t *testing.T) {
+	pages := fstest.MapFS{
+		"wide.png":   {Data: []byte(widePage(t))},
+		"broken.png": {Data: []byte("\x89PNG\r\n\x1a\n but not really")},
+	}
+
+	var index bytes.Buffer
+	if err := writeIndexHTML(&index, pages, []string{"wide.png", "broken.png"}, comicInfo{Title: "Book"}, viewerOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// pages keep their shape while loading, those that can't be read are
+	// left to size themselves
+	for _, want := range []string{
+		`<img id="page-1" src="wide.png" alt="wide.png" width="400" height="100" data-width="400" data-height="100" loading="lazy">`,
+		`<img id="page-2" src="broken.png" alt="broken.png" loading="lazy">`,
+	} {
+		if !strings.Contains(index.String(), want) {
+			t.Errorf("index doesn't contain %s", want)
+		}
+	}
+}
+
+func TestIndexHelp(t *testing.T) {
+	// ? opens the list of shortcuts, which only has the bookmark and book
+	// keys when there are bookmarks and books to go to
+	help := []string{
+		`<button class="help-toggle" type="button">Keys</button>`,
+		`<div class="overlay help" hidden>`,
+		"<h1>Keyboard shortcuts</h1>",
+		`setupOverlay(document.querySelector(".help"), document.querySelector(".help-toggle"), "?");`,
+		"<dt><kbd>?</kbd></dt>",
+		"<dt><kbd>Esc</kbd></dt>",
+	}
+	checkIndex(t, []indexTest{
+		{name: "book", want: help, notWant: []string{"<dt><kbd>b</kbd></dt>", "<dt><kbd>{</kbd><kbd>}</kbd></dt>"}},
+		{name: "bookmarks", opts: viewerOptions{Bookmarks: true}, want: slices.Concat(help, []string{"<dt><kbd>b</kbd></dt>", "<dt><kbd>m</kbd></dt>"})},
+		{name: "in a library", opts: viewerOptions{NextBook: "../b.cbz"}, want: slices.Concat(help, []string{"<dt><kbd>{</kbd><kbd>}</kbd></dt>"})},
+	})
+}
+
+func TestLoadTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{name: "custom", text: `<title>{{.Info.Title}}</title>{{range .Pages}}<img src="{{.URL}}">{{end}}`},
+		{name: "doesn't parse", text: `{{range .Pages}}`, wantErr: true},
+		// parses, but fails once there's a book to show
+		{name: "no such field", text: `{{.Cover}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "index.html.tmpl")
+		if err := os.WriteFile(path, []byte(tt.text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		tpl, err := LoadTemplate(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		// the viewer is written with it rather than the built-in one
+		want := `<title>Book</title><img src="1.png"><img src="2.png"><img src="3.png">`
+		if got := renderIndex(t, viewerOptions{template: tpl}); got != want {
+			t.Errorf("%s: index %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestIndexScrollZoom(t *testing.T) {
+	// in scroll mode only Ctrl+wheel and a two finger pinch zoom, and a
+	// pinch keeps the browser from scrolling along with it
+	checkIndex(t, []indexTest{{
+		name: "scroll",
+		opts: viewerOptions{Scroll: true},
+		want: []string{
+			`data-mode="scroll"`,
+			"setupScrollZoom();\n            return;",
+			"if (!event.ctrlKey) {\n                    return;\n                }",
+			"if (event.touches.length === 2) {\n                    pinch = {distance: distance(event.touches), scale: scale};",
+			"if (!pinch || event.touches.length !== 2) {\n                    return;\n                }",
+			"event.preventDefault();\n                const x = ",
+			"}, {passive: false});",
+		},
+	}})
+}
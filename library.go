@@ -0,0 +1,340 @@
+package cbzopen
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+//go:embed library.html.tmpl
+var libraryHTML embed.FS
+
+var archiveExtensions = []string{".cbz", ".cbr", ".cb7", ".cbt"}
+
+func isArchive(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return slices.Contains(archiveExtensions, ext)
+}
+
+// hasArchives reports whether dir directly contains any archives.
+func hasArchives(dir string) bool {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && isArchive(file.Name()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsLibrary reports whether path is a directory of archives, which is served
+// as a library rather than as a single book.
+func IsLibrary(path string) bool {
+	fileInfo, err := os.Stat(path)
+	return err == nil && fileInfo.IsDir() && hasArchives(path)
+}
+
+// library serves a directory of archives: a landing page listing them at /,
+// and each archive's viewer under /books/<name>/. Archives are opened the
+// first time they're visited and kept open until the library is closed.
+//
+// Images are listed as albums next to the archives: each folder in the
+// library with images directly in it is one, and the loose images at the
+// top of the library are another, named after the library and listed
+// first.
+type library struct {
+	dir   string
+	names []string
+	// paths holds where each of names is on disk, an archive or a folder
+	paths map[string]string
+	opts  bookOptions
+	// coverDir caches the cover thumbnails for the landing page
+	coverDir string
+
+	handler http.Handler
+	// ctx is what books are opened with, so one keeps opening after the
+	// reader who asked for it leaves, until the library is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	books map[string]*libraryBook
+	// empty holds the archives found to have no pages, which are left out
+	// of the index from then on
+	empty map[string]bool
+}
+
+func openLibrary(dir string, opts bookOptions) (*library, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var names []string
+	paths := map[string]string{}
+	looseImages := false
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(dir, name)
+		switch {
+		case file.IsDir():
+			if !strings.HasPrefix(name, ".") && !isJunk(name+"/") && hasPages(path, opts.extensions) {
+				names = append(names, name)
+				paths[name] = path
+			}
+		case isArchive(name):
+			names = append(names, name)
+			paths[name] = path
+		case file.Type().IsRegular() && isPage(os.DirFS(dir), name, opts.extensions):
+			looseImages = true
+		}
+	}
+
+	slices.SortFunc(names, naturalCompare)
+
+	if looseImages {
+		album := looseAlbumName(dir, names)
+		names = append([]string{album}, names...)
+		// the album is opened like any folder of images, which only serves
+		// the pages directly in it, not the archives and folders around them
+		paths[album] = dir
+	}
+
+	coverDir, err := os.MkdirTemp(opts.tempDir, "cbzopen-covers-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cover directory: %w", err)
+	}
+
+	l := &library{
+		dir:      dir,
+		names:    names,
+		paths:    paths,
+		opts:     opts,
+		coverDir: coverDir,
+		books:    map[string]*libraryBook{},
+		empty:    map[string]bool{},
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", l.serveIndex)
+	mux.HandleFunc("/index.html", l.serveIndex)
+	mux.HandleFunc("/books/{name}/", l.serveBook)
+	mux.HandleFunc("GET /covers/{name}", l.serveCover)
+	mux.HandleFunc("GET /opds", l.serveOPDS)
+	mux.HandleFunc("GET /files/{name}", l.serveFile)
+	l.handler = mux
+
+	return l, nil
+}
+
+// looseAlbumName names the album of the images at the top of dir after dir
+// itself, unless one of names already has that name.
+func looseAlbumName(dir string, names []string) string {
+	album := "Images"
+	if abs, err := filepath.Abs(dir); err == nil && filepath.Base(abs) != string(filepath.Separator) {
+		album = filepath.Base(abs)
+	}
+
+	for slices.Contains(names, album) {
+		album += " (images)"
+	}
+
+	return album
+}
+
+func (l *library) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.handler.ServeHTTP(w, r)
+}
+
+type libraryEntry struct {
+	Name  string
+	URL   string
+	Cover string
+}
+
+// libraryTemplate parses library.html.tmpl once, rather than for every
+// visit to the landing page.
+var libraryTemplate = sync.OnceValues(func() (*template.Template, error) {
+	return template.New("library.html.tmpl").ParseFS(libraryHTML, "library.html.tmpl")
+})
+
+func (l *library) serveIndex(w http.ResponseWriter, r *http.Request) {
+	tpl, err := libraryTemplate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	l.mu.Lock()
+	var entries []libraryEntry
+	for _, name := range l.names {
+		if !l.empty[name] {
+			entries = append(entries, libraryEntry{
+				Name:  name,
+				URL:   "books/" + pageURL(name) + "/",
+				Cover: "covers/" + pageURL(name),
+			})
+		}
+	}
+	l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tpl.Execute(w, entries); err != nil {
+		slog.Error("Failed to render library index", "err", err)
+	}
+}
+
+func (l *library) serveBook(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	b, err := l.book(r.Context(), name)
+	if r.Context().Err() != nil {
+		// the reader left, the book goes on opening for the next one
+		return
+	}
+	if errors.Is(err, ErrNoPages) {
+		http.Error(w, fmt.Sprintf("%s has no pages", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to open book", "file", name, "err", err)
+		http.Error(w, fmt.Sprintf("failed to open %s", name), http.StatusInternalServerError)
+		return
+	}
+	if b == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.StripPrefix("/books/"+name, b).ServeHTTP(w, r)
+}
+
+// neighbors returns the names before and after name in names, or "" at
+// either end.
+func neighbors(names []string, name string) (string, string) {
+	i := slices.Index(names, name)
+	if i < 0 {
+		return "", ""
+	}
+
+	var previous, next string
+	if i > 0 {
+		previous = names[i-1]
+	}
+	if i < len(names)-1 {
+		next = names[i+1]
+	}
+
+	return previous, next
+}
+
+// libraryBook is a book in a library, opened once by whichever request
+// gets to it first while the others wait for done.
+type libraryBook struct {
+	done chan struct{}
+	book *book
+	err  error
+}
+
+// book returns the opened archive for name, opening it on first use. It
+// returns nil if name isn't an archive in the library. Opening doesn't hold
+// up the rest of the library, and goes on if ctx is done first.
+func (l *library) book(ctx context.Context, name string) (*book, error) {
+	if !slices.Contains(l.names, name) {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	entry, ok := l.books[name]
+	if !ok {
+		if l.empty[name] {
+			l.mu.Unlock()
+			return nil, ErrNoPages
+		}
+
+		entry = &libraryBook{done: make(chan struct{})}
+		l.books[name] = entry
+		go l.open(name, entry, l.bookOptions(name))
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.book, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// bookOptions returns the options to open name with. l.mu must be held.
+func (l *library) bookOptions(name string) bookOptions {
+	// link past the archives already found empty, like the index does
+	listed := slices.DeleteFunc(slices.Clone(l.names), func(n string) bool { return l.empty[n] })
+	opts := l.opts
+	previous, next := neighbors(listed, name)
+	if previous != "" {
+		opts.viewer.PreviousBook = "../" + pageURL(previous) + "/"
+	}
+	if next != "" {
+		opts.viewer.NextBook = "../" + pageURL(next) + "/"
+	}
+
+	return opts
+}
+
+// open opens name into entry. A book that fails to open is tried again on
+// the next visit, unless it has no pages.
+func (l *library) open(name string, entry *libraryBook, opts bookOptions) {
+	defer close(entry.done)
+
+	slog.Info("Opening book", "file", name)
+	entry.book, entry.err = openBook(l.ctx, l.paths[name], opts)
+	if entry.err == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if errors.Is(entry.err, ErrNoPages) {
+		l.empty[name] = true
+	}
+	if l.books[name] == entry {
+		delete(l.books, name)
+	}
+}
+
+// Close stops the archives still opening and closes every one opened so
+// far.
+func (l *library) Close() {
+	l.cancel()
+
+	l.mu.Lock()
+	books := l.books
+	l.books = map[string]*libraryBook{}
+	l.mu.Unlock()
+
+	for _, entry := range books {
+		<-entry.done
+		if entry.book != nil {
+			entry.book.Close()
+		}
+	}
+
+	removeAllWithLog(l.coverDir, "cover directory")
+}
@@ -0,0 +1,234 @@
+package cbzopen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeLibrary puts a one page archive for each of names in a new directory
+// and returns it.
+func writeLibrary(t *testing.T, names ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	page := pngData(t, color.White)
+	for _, name := range names {
+		data, err := os.ReadFile(writeZip(t, []testEntry{{name: "1.png", data: page}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLibraryIndex(t *testing.T) {
+	dir := writeLibrary(t, "b.cbz", "a.cbz")
+	l, err := openLibrary(dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := w.Body.String()
+	for _, name := range []string{"a.cbz", "b.cbz"} {
+		if !strings.Contains(body, `href="books/`+name+`/"`) {
+			t.Errorf("landing page doesn't link to %s", name)
+		}
+	}
+}
+
+func TestLibraryBookOpensOnce(t *testing.T) {
+	dir := writeLibrary(t, "a.cbz")
+	l, err := openLibrary(dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a reader who leaves before the book opens doesn't stop it opening;
+	// they may still get it if it opened quickly enough
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.book(cancelled, "a.cbz"); err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("book with a cancelled context: %v, want %v", err, context.Canceled)
+	}
+
+	books := make([]*book, 4)
+	var wg sync.WaitGroup
+	for i := range books {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := l.book(context.Background(), "a.cbz")
+			if err != nil {
+				t.Error(err)
+			}
+			books[i] = b
+		}()
+	}
+	wg.Wait()
+
+	for _, b := range books {
+		if b == nil || b != books[0] {
+			t.Fatalf("got books %v, want the same one every time", books)
+		}
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	names := []string{"vol1.cbz", "vol2.cbz", "vol10.cbz"}
+
+	tests := []struct {
+		name, wantPrevious, wantNext string
+	}{
+		{name: "vol1.cbz", wantNext: "vol2.cbz"},
+		{name: "vol2.cbz", wantPrevious: "vol1.cbz", wantNext: "vol10.cbz"},
+		{name: "vol10.cbz", wantPrevious: "vol2.cbz"},
+		{name: "missing.cbz"},
+	}
+
+	for _, tt := range tests {
+		if previous, next := neighbors(names, tt.name); previous != tt.wantPrevious || next != tt.wantNext {
+			t.Errorf("neighbors of %s = %q, %q, want %q, %q", tt.name, previous, next, tt.wantPrevious, tt.wantNext)
+		}
+	}
+}
+
+func TestLibraryBookLinks(t *testing.T) {
+	dir := writeLibrary(t, "vol 10.cbz", "vol 2.cbz", "vol 1.cbz")
+	l, err := openLibrary(dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// books are in natural order, and the first and last link only one way
+	tests := []struct {
+		name    string
+		want    []string
+		notWant []string
+	}{
+		{name: "vol 1.cbz", want: []string{`<a class="next-book" href="../vol%202.cbz/">`}, notWant: []string{`class="previous-book"`}},
+		{name: "vol 2.cbz", want: []string{`<a class="previous-book" href="../vol%201.cbz/">`, `<a class="next-book" href="../vol%2010.cbz/">`}},
+		{name: "vol 10.cbz", want: []string{`<a class="previous-book" href="../vol%202.cbz/">`}, notWant: []string{`class="next-book"`}},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/books/"+strings.ReplaceAll(tt.name, " ", "%20")+"/", nil))
+		index := w.Body.String()
+		for _, want := range tt.want {
+			if !strings.Contains(index, want) {
+				t.Errorf("%s: viewer doesn't contain %s", tt.name, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(index, notWant) {
+				t.Errorf("%s: viewer contains %s", tt.name, notWant)
+			}
+		}
+	}
+}
+
+func TestLibraryAlbums(t *testing.T) {
+	dir := writeLibrary(t, "b.cbz", "a.cbz")
+	album := filepath.Base(dir)
+
+	page := pngData(t, color.White)
+	for _, name := range []string{
+		"cover.png",
+		"notes.txt",
+		"scans/1.png",
+		// only the library's own folders are albums
+		"scans/more/2.png",
+		"nested/more/1.png",
+		".hidden/1.png",
+		"__MACOSX/1.png",
+		"text/notes.txt",
+	} {
+		data := page
+		if filepath.Ext(name) == ".txt" {
+			data = "not a page"
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := openLibrary(dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the loose images come first, named after the library
+	if want := []string{album, "a.cbz", "b.cbz", "scans"}; !slices.Equal(l.names, want) {
+		t.Fatalf("library lists %q, want %q", l.names, want)
+	}
+
+	// each album only has the pages directly in its folder
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: album, want: []string{"cover.png"}},
+		{name: "scans", want: []string{"1.png"}},
+		{name: "a.cbz", want: []string{"1.png"}},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/books/"+tt.name+"/api/pages", nil))
+		var pages apiPages
+		if err := json.NewDecoder(w.Body).Decode(&pages); err != nil {
+			t.Fatalf("%s: status %d: %v", tt.name, w.Code, err)
+		}
+		var got []string
+		for _, p := range pages.Pages {
+			got = append(got, p.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: pages %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLooseAlbumName(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Shelf")
+
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{names: []string{"a.cbz"}, want: "Shelf"},
+		// a folder by the same name keeps its name
+		{names: []string{"Shelf"}, want: "Shelf (images)"},
+		{names: []string{"Shelf", "Shelf (images)"}, want: "Shelf (images) (images)"},
+	}
+
+	for _, tt := range tests {
+		if got := looseAlbumName(dir, tt.names); got != tt.want {
+			t.Errorf("%q: %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultMemoryLimit is the default for Options.MemoryLimit.
+const DefaultMemoryLimit = 1 * GiB
+
+// errTooBigForMemory is returned by openInMemory for archives whose pages
+// don't fit under the memory limit, which are extracted to disk instead.
+var errTooBigForMemory = errors.New("pages don't fit in memory")
+
+// memFS holds a book's pages in memory, for Options.InMemory. Only the top
+// level can be opened as a directory, which is all the file server needs to
+// find index.html.
+type memFS struct {
+	files   map[string][]byte
+	index   []byte
+	created time.Time
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	switch name {
+	case ".":
+		return &memDir{info: memFileInfo{name: ".", modTime: m.created, dir: true}}, nil
+	case "index.html":
+		return newMemFile(name, m.index, m.created), nil
+	}
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return newMemFile(path.Base(name), data, m.created), nil
+}
+
+type memDir struct {
+	info memFileInfo
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// openInMemory reads the archive's pages into a memFS instead of extracting
+// them, returning errTooBigForMemory if they add up to more than
+// opts.memoryLimit. The archive is read through once, front to back, which
+// is the only way to read tar and solid rar archives without starting over
+// for every page.
+func (b *book) openInMemory(ctx context.Context, opts bookOptions) error {
+	format, err := detectFormat(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	enc := opts.extraction.filenameEncoding
+
+	// zip and 7z list their files up front, so the sizes in the headers
+	// tell early on whether it's worth trying; rar and tar would have to be
+	// read through an extra time for that, so their progress goes without
+	// a total
+	total := 0
+	if format == formatZip || format == formatSevenZip {
+		var listed int64
+		err := walkEntries(b.path, format, enc, func(raw string, size int64, open func() (io.ReadCloser, error)) error {
+			if name, ok := memEntryName(raw); ok && open != nil && mayBePage(name, opts.extensions) {
+				listed += size
+				total++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", explainArchiveError(b.path, err))
+		}
+		if opts.memoryLimit > 0 && ByteSize(listed) > opts.memoryLimit {
+			return errTooBigForMemory
+		}
+	}
+
+	files := map[string][]byte{}
+	var comicInfoData []byte
+	var comicInfoName string
+	var used ByteSize
+	var skipped []string
+	err = walkEntries(b.path, format, enc, func(raw string, size int64, open func() (io.ReadCloser, error)) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name, ok := memEntryName(raw)
+		if !ok || open == nil {
+			return nil
+		}
+		isComicInfo := strings.EqualFold(name, "ComicInfo.xml")
+		if !isComicInfo && !mayBePage(name, opts.extensions) {
+			return nil
+		}
+
+		// headers can lie about sizes, so count what's actually read too
+		limit := maxPageSize
+		if opts.memoryLimit > 0 && !isComicInfo {
+			if ByteSize(size) > opts.memoryLimit-used {
+				return errTooBigForMemory
+			}
+			limit = min(limit, opts.memoryLimit-used)
+		}
+		data, ok, err := readAtMost(ctx, open, limit)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && opts.extraction.skipErrors {
+			slog.Warn("Skipping file that can't be read", "file", name, "err", err)
+			skipped = append(skipped, name)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, explainArchiveError(b.path, err))
+		}
+		if !ok && limit < maxPageSize {
+			return errTooBigForMemory
+		}
+		if !ok {
+			return fmt.Errorf("%s is larger than %v", name, &limit)
+		}
+
+		if isComicInfo {
+			comicInfoData, comicInfoName = data, name
+			return nil
+		}
+		// a file without an extension is only a page if it's an image
+		if !isImage(name, opts.extensions) && !isSniffedImage(data[:min(len(data), sniffLen)]) {
+			return nil
+		}
+		used += ByteSize(len(data))
+
+		key := name
+		if !opts.extraction.preserveStructure {
+			key = path.Base(name)
+			if _, ok := files[key]; ok {
+				slog.Warn("Archive has more than one file with this name, pass -preserve-structure to keep both", "file", key)
+			}
+		}
+		files[key] = data
+
+		if opts.extraction.progress != nil {
+			opts.extraction.progress(Progress{Files: len(files), Total: total, Bytes: used})
+		}
+
+		return nil
+	})
+	if errors.Is(err, errTooBigForMemory) || ctx.Err() != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", explainArchiveError(b.path, err))
+	}
+	if len(skipped) > 0 {
+		slog.Warn("Some files couldn't be read and were left out", "file", b.path, "count", len(skipped), "skipped", skipped)
+	}
+	// the total is known now, and may be fewer than listed once files
+	// without an extension turn out not to be images
+	if opts.extraction.progress != nil && len(files) > 0 && total != len(files) {
+		opts.extraction.progress(Progress{Files: len(files), Total: len(files), Bytes: used})
+	}
+
+	pages := &memFS{files: files, created: time.Now()}
+
+	b.info = decodeComicInfo(comicInfoData, comicInfoName, b.path)
+	b.imageFiles = orderPages(imagePagesFS(pages, slices.Collect(maps.Keys(files)), opts.extensions, opts.order), b.info)
+	b.imageFiles = omitRepeats(pages, b.imageFiles, opts.viewer)
+
+	var index bytes.Buffer
+	if err := writeIndexHTML(&index, pages, b.imageFiles, b.info, opts.viewer); err != nil {
+		return fmt.Errorf("failed to create index.html: %w", err)
+	}
+	pages.index = index.Bytes()
+
+	b.pages = pages
+
+	return nil
+}
+
+// memEntryName returns the raw name of an archive entry as a valid fs.FS
+// path, or false for names that can't be one and junk like __MACOSX/.
+func memEntryName(raw string) (string, bool) {
+	name := path.Clean(strings.TrimPrefix(raw, "/"))
+	return name, fs.ValidPath(name) && name != "." && !isJunk(name)
+}
+
+// mayBePage reports whether name is worth reading to find out if it's a
+// page: an image with one of exts, or a file without any extension, which
+// is sniffed once read.
+func mayBePage(name string, exts []string) bool {
+	return isImage(name, exts) || path.Ext(name) == ""
+}
+
+// readAtMost reads the file open opens, reporting false if it's larger than
+// limit.
+func readAtMost(ctx context.Context, open func() (io.ReadCloser, error), limit ByteSize) ([]byte, bool, error) {
+	r, err := open()
+	if err != nil {
+		return nil, false, err
+	}
+	defer closeWithLog(r, "page")
+
+	data, err := io.ReadAll(&contextReader{ctx: ctx, r: io.LimitReader(r, int64(limit)+1)})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, ByteSize(len(data)) <= limit, nil
+}
@@ -0,0 +1,108 @@
+package cbzopen
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeTar writes entries as a tar file, gzipped if compress is set, in a
+// new temporary directory and returns its path. Entries with a symlink mode
+// are written as links to their data.
+func writeTar(t *testing.T, entries []testEntry, compress bool) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), "book.cbt")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeWithLog(f, "test tar")
+
+	var w io.Writer = f
+	if compress {
+		gzipWriter := gzip.NewWriter(f)
+		defer closeWithLog(gzipWriter, "test gzip")
+		w = gzipWriter
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(entry.data))}
+		if entry.mode&os.ModeSymlink != 0 {
+			header = &tar.Header{Name: entry.name, Mode: 0o777, Typeflag: tar.TypeSymlink, Linkname: entry.data}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(entry.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func TestOpenInMemoryTar(t *testing.T) {
+	white, black := pngData(t, color.White), pngData(t, color.Black)
+	entries := []testEntry{
+		{name: "1.png", data: white},
+		{name: "link.png", data: "1.png", mode: os.ModeSymlink},
+		{name: "ch2/2.png", data: black},
+		{name: "notes.txt", data: "not a page"},
+	}
+
+	for _, compress := range []bool{false, true} {
+		archivePath := writeTar(t, entries, compress)
+
+		var progress []Progress
+		opts := Options{InMemory: true, TempDir: t.TempDir(), Progress: func(p Progress) { progress = append(progress, p) }}
+		b, err := openBook(context.Background(), archivePath, opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		pages, ok := b.pages.(*memFS)
+		if !ok {
+			t.Fatalf("gzip %v: pages are a %T, want a *memFS", compress, b.pages)
+		}
+
+		var names []string
+		for name := range pages.files {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		if want := []string{"1.png", "2.png"}; !slices.Equal(names, want) {
+			t.Errorf("gzip %v: read %v, want %v", compress, names, want)
+		}
+		if string(pages.files["2.png"]) != black {
+			t.Errorf("gzip %v: 2.png doesn't hold what was archived", compress)
+		}
+
+		// the archive is read once, so there's no total until the end
+		if len(progress) != 3 {
+			t.Fatalf("gzip %v: progress reported %d times, want 3", compress, len(progress))
+		}
+		for _, p := range progress[:2] {
+			if p.Total != 0 {
+				t.Errorf("gzip %v: progress %+v has a total before the archive was read", compress, p)
+			}
+		}
+		if last := progress[2]; last.Files != 2 || last.Total != 2 {
+			t.Errorf("gzip %v: last progress %+v, want 2 of 2 files", compress, last)
+		}
+	}
+}
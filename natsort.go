@@ -0,0 +1,155 @@
+package cbzopen
+
+import (
+	"path"
+	"strings"
+)
+
+// Page sort orders, see Options.Sort.
+const (
+	// SortFullNatural compares names run by run, numbers by value, e.g.
+	// "Vol.1 Ch.03 - 012.jpg" by volume, then chapter, then page.
+	SortFullNatural = "full-natural"
+	// SortFirstNumber compares names by the first number in them.
+	SortFirstNumber = "first-number"
+	// SortLastNumber compares names by the last number in them, for
+	// scanners that put the page number at the end after inconsistent
+	// prefixes.
+	SortLastNumber = "last-number"
+)
+
+// SortOrders are the ways pages can be sorted by name.
+var SortOrders = []string{SortFullNatural, SortFirstNumber, SortLastNumber}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+// nextRun returns the leading run of s made up entirely of digits or entirely
+// of non-digits, along with the rest of s.
+func nextRun(s string) (string, string) {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+// compareNumeric compares two digit runs by their numeric value without
+// converting them, so arbitrarily long runs don't overflow.
+func compareNumeric(a, b string) int {
+	trimmedA := strings.TrimLeft(a, "0")
+	trimmedB := strings.TrimLeft(b, "0")
+
+	if len(trimmedA) != len(trimmedB) {
+		return len(trimmedA) - len(trimmedB)
+	}
+
+	return strings.Compare(trimmedA, trimmedB)
+}
+
+// naturalCompare orders strings so that embedded numbers compare by value,
+// e.g. "page2.jpg" sorts before "page10.jpg". Names that are equal under
+// natural ordering (like "01.jpg" and "1.jpg") fall back to a plain
+// comparison so the result is deterministic.
+func naturalCompare(a, b string) int {
+	restA, restB := a, b
+	for restA != "" && restB != "" {
+		var runA, runB string
+		runA, restA = nextRun(restA)
+		runB, restB = nextRun(restB)
+
+		var c int
+		if isDigit(runA[0]) && isDigit(runB[0]) {
+			c = compareNumeric(runA, runB)
+		} else {
+			c = strings.Compare(runA, runB)
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	if c := len(restA) - len(restB); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a, b)
+}
+
+// pageOrder returns the comparison for sorting page names by sort, one of
+// SortOrders; anything else is SortFullNatural.
+func pageOrder(sort string) func(a, b string) int {
+	switch sort {
+	case SortFirstNumber:
+		return numberCompare(firstNumber)
+	case SortLastNumber:
+		return numberCompare(lastNumber)
+	default:
+		return naturalCompare
+	}
+}
+
+// numberCompare orders page names by the number key picks out of their file
+// names, folder by folder. Names without a number come first, like a
+// "cover.jpg" before the numbered pages, and ties fall back to
+// naturalCompare.
+func numberCompare(key func(name string) (string, bool)) func(a, b string) int {
+	return func(a, b string) int {
+		if c := naturalCompare(path.Dir(a), path.Dir(b)); c != 0 {
+			return c
+		}
+
+		numberA, okA := key(path.Base(a))
+		numberB, okB := key(path.Base(b))
+		switch {
+		case okA && okB:
+			if c := compareNumeric(numberA, numberB); c != 0 {
+				return c
+			}
+		case okA:
+			return 1
+		case okB:
+			return -1
+		}
+
+		return naturalCompare(a, b)
+	}
+}
+
+// digitRuns returns the runs of digits in name, leaving out its extension
+// so the 2 in ".jp2" isn't taken for a page number.
+func digitRuns(name string) []string {
+	var runs []string
+	rest := strings.TrimSuffix(name, path.Ext(name))
+	for rest != "" {
+		var run string
+		run, rest = nextRun(rest)
+		if isDigit(run[0]) {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs
+}
+
+func firstNumber(name string) (string, bool) {
+	runs := digitRuns(name)
+	if len(runs) == 0 {
+		return "", false
+	}
+
+	return runs[0], true
+}
+
+func lastNumber(name string) (string, bool) {
+	runs := digitRuns(name)
+	if len(runs) == 0 {
+		return "", false
+	}
+
+	return runs[len(runs)-1], true
+}
@@ -0,0 +1,110 @@
+package cbzopen
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"page2.jpg", "page10.jpg", -1},
+		{"page10.jpg", "page2.jpg", 1},
+		{"page2.jpg", "page2.jpg", 0},
+		// leading zeros don't change the value, and ties fall back to a
+		// plain comparison
+		{"001.jpg", "10.jpg", -1},
+		{"010.jpg", "9.jpg", 1},
+		{"001.jpg", "1.jpg", -1},
+		{"0000000000000000000002.jpg", "10.jpg", -1},
+		// case matters, upper before lower like a plain comparison
+		{"Page10.jpg", "page2.jpg", -1},
+		{"cover.jpg", "Cover.jpg", 1},
+		// digits at the end
+		{"page", "page1", -1},
+		{"page9", "page10", -1},
+		{"ch1_p2.png", "ch1_p10.png", -1},
+		{"ch2_p1.png", "ch10_p1.png", -1},
+		// names differing only by extension
+		{"1.jpg", "1.png", -1},
+		// numbers longer than an int64 don't overflow
+		{"99999999999999999999999.jpg", "100000000000000000000000.jpg", -1},
+	}
+
+	for _, tt := range tests {
+		got := naturalCompare(tt.a, tt.b)
+		if sign(got) != tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestNaturalSort(t *testing.T) {
+	names := []string{"10.jpg", "9.jpg", "001.jpg", "ch1_p2.png", "ch1_p10.png", "ch1_p1.png"}
+	slices.SortFunc(names, naturalCompare)
+
+	want := []string{"001.jpg", "9.jpg", "10.jpg", "ch1_p1.png", "ch1_p2.png", "ch1_p10.png"}
+	if !slices.Equal(names, want) {
+		t.Errorf("sorted %v, want %v", names, want)
+	}
+}
+
+func TestPageOrder(t *testing.T) {
+	names := []string{"v2 p001.jpg", "scan 05.jp2", "Vol.1 Ch.03 - 012.jpg", "cover.jpg", "Vol.1 Ch.02 - 013.jpg"}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{sort: SortFullNatural, want: []string{"Vol.1 Ch.02 - 013.jpg", "Vol.1 Ch.03 - 012.jpg", "cover.jpg", "scan 05.jp2", "v2 p001.jpg"}},
+		// names without a number come first, and the volume ties are broken
+		// by the rest of the name
+		{sort: SortFirstNumber, want: []string{"cover.jpg", "Vol.1 Ch.02 - 013.jpg", "Vol.1 Ch.03 - 012.jpg", "v2 p001.jpg", "scan 05.jp2"}},
+		// the 2 in .jp2 isn't a page number
+		{sort: SortLastNumber, want: []string{"cover.jpg", "v2 p001.jpg", "scan 05.jp2", "Vol.1 Ch.03 - 012.jpg", "Vol.1 Ch.02 - 013.jpg"}},
+		{sort: "", want: []string{"Vol.1 Ch.02 - 013.jpg", "Vol.1 Ch.03 - 012.jpg", "cover.jpg", "scan 05.jp2", "v2 p001.jpg"}},
+	}
+
+	for _, tt := range tests {
+		got := slices.Clone(names)
+		slices.SortFunc(got, pageOrder(tt.sort))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: sorted %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestPageOrderFolders(t *testing.T) {
+	// folders stay together in order, whatever the numbers in the pages
+	names := []string{"ch10/p1.jpg", "ch2/p9 x1.jpg", "ch2/p10 x0.jpg"}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{sort: SortFullNatural, want: []string{"ch2/p9 x1.jpg", "ch2/p10 x0.jpg", "ch10/p1.jpg"}},
+		{sort: SortFirstNumber, want: []string{"ch2/p9 x1.jpg", "ch2/p10 x0.jpg", "ch10/p1.jpg"}},
+		{sort: SortLastNumber, want: []string{"ch2/p10 x0.jpg", "ch2/p9 x1.jpg", "ch10/p1.jpg"}},
+	}
+
+	for _, tt := range tests {
+		got := slices.Clone(names)
+		slices.SortFunc(got, pageOrder(tt.sort))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: sorted %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
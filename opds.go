@@ -0,0 +1,139 @@
+package cbzopen
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// archiveTypes are the media types e-reader apps expect for each archive
+// format in acquisition links.
+var archiveTypes = map[string]string{
+	".cbz": "application/vnd.comicbook+zip",
+	".cbr": "application/vnd.comicbook-rar",
+	".cb7": "application/x-cb7",
+	".cbt": "application/x-cbt",
+}
+
+const (
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsAcquisitionRel  = "http://opds-spec.org/acquisition"
+	opdsImageRel        = "http://opds-spec.org/image"
+	opdsThumbnailRel    = "http://opds-spec.org/image/thumbnail"
+)
+
+// opdsFeed is the subset of an OPDS 1.2 acquisition feed needed to browse
+// and download the library's archives.
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []opdsLink `xml:"link"`
+}
+
+type opdsLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+func opdsTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// serveOPDS lists the library's archives as an OPDS feed, with links
+// relative to /opds.
+func (l *library) serveOPDS(w http.ResponseWriter, r *http.Request) {
+	feed := opdsFeed{
+		ID:    "urn:cbzopen:library",
+		Title: "cbzopen",
+		Links: []opdsLink{
+			{Rel: "self", Href: "opds", Type: opdsAcquisitionType},
+			{Rel: "start", Href: "opds", Type: opdsAcquisitionType},
+		},
+	}
+
+	l.mu.Lock()
+	names := slices.DeleteFunc(slices.Clone(l.names), func(n string) bool { return l.empty[n] })
+	l.mu.Unlock()
+
+	var updated time.Time
+	for _, name := range names {
+		fileInfo, err := os.Stat(l.paths[name])
+		if err != nil {
+			slog.Warn("Failed to read archive", "file", name, "err", err)
+			continue
+		}
+		if fileInfo.ModTime().After(updated) {
+			updated = fileInfo.ModTime()
+		}
+
+		// albums have no file of their own, so they're downloaded as the zip
+		// the viewer's "Download all" makes
+		title := name
+		acquisition := opdsLink{Rel: opdsAcquisitionRel, Href: "books/" + pageURL(name) + "/download", Type: "application/zip"}
+		if !fileInfo.IsDir() {
+			ext := strings.ToLower(filepath.Ext(name))
+			title = strings.TrimSuffix(name, filepath.Ext(name))
+			acquisition = opdsLink{Rel: opdsAcquisitionRel, Href: "files/" + pageURL(name), Type: archiveTypes[ext]}
+		}
+
+		feed.Entries = append(feed.Entries, opdsEntry{
+			ID:      "urn:cbzopen:book:" + pageURL(name),
+			Title:   title,
+			Updated: opdsTime(fileInfo.ModTime()),
+			Links: []opdsLink{
+				acquisition,
+				{Rel: opdsImageRel, Href: "covers/" + pageURL(name), Type: "image/jpeg"},
+				{Rel: opdsThumbnailRel, Href: "covers/" + pageURL(name), Type: "image/jpeg"},
+				{Rel: "alternate", Href: "books/" + pageURL(name) + "/", Type: "text/html"},
+			},
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = opdsTime(updated)
+
+	w.Header().Set("Content-Type", opdsAcquisitionType)
+	_, _ = w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		slog.Error("Failed to write OPDS feed", "err", err)
+	}
+}
+
+// serveFile sends an archive as it is, for the OPDS acquisition links.
+func (l *library) serveFile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(l.names, name) {
+		http.NotFound(w, r)
+		return
+	}
+	if fileInfo, err := os.Stat(l.paths[name]); err != nil || fileInfo.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if archiveType, ok := archiveTypes[strings.ToLower(filepath.Ext(name))]; ok {
+		w.Header().Set("Content-Type", archiveType)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeFile(w, r, l.paths[name])
+}
@@ -0,0 +1,76 @@
+package cbzopen
+
+import (
+	"encoding/xml"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServeOPDS(t *testing.T) {
+	dir := writeLibrary(t, "b.cbz", "a.cbz")
+	// a folder of images is an album, downloaded as a zip of its pages
+	if err := os.Mkdir(filepath.Join(dir, "c album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c album", "1.png"), []byte(pngData(t, color.White)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := openLibrary(dir, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/opds")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != opdsAcquisitionType {
+		t.Fatalf("status %d with Content-Type %q, want %d with %s", w.Code, w.Header().Get("Content-Type"), http.StatusOK, opdsAcquisitionType)
+	}
+
+	var feed opdsFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" || feed.ID == "" {
+		t.Errorf("feed %v with id %q, want an Atom feed with an id", feed.XMLName, feed.ID)
+	}
+	if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+		t.Errorf("feed updated: %v", err)
+	}
+
+	want := []struct {
+		title       string
+		acquisition opdsLink
+	}{
+		{"a", opdsLink{Rel: opdsAcquisitionRel, Href: "files/a.cbz", Type: "application/vnd.comicbook+zip"}},
+		{"b", opdsLink{Rel: opdsAcquisitionRel, Href: "files/b.cbz", Type: "application/vnd.comicbook+zip"}},
+		{"c album", opdsLink{Rel: opdsAcquisitionRel, Href: "books/c%20album/download", Type: "application/zip"}},
+	}
+	if len(feed.Entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(feed.Entries), len(want))
+	}
+	for i, entry := range feed.Entries {
+		if entry.Title != want[i].title || entry.ID == "" || len(entry.Links) == 0 || !reflect.DeepEqual(entry.Links[0], want[i].acquisition) {
+			t.Errorf("entry %d is %+v, want %s acquired by %+v", i, entry, want[i].title, want[i].acquisition)
+			continue
+		}
+		// the links are relative to /opds, and each one works
+		for _, link := range entry.Links {
+			if w := get("/" + link.Href); w.Code != http.StatusOK {
+				t.Errorf("%s: %s %s: status %d, want %d", entry.Title, link.Rel, link.Href, w.Code, http.StatusOK)
+			}
+		}
+	}
+}
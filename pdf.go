@@ -0,0 +1,235 @@
+package cbzopen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// pdfWriter writes a PDF with one image per page. Objects are numbered in
+// the order they're written, with the catalog and page tree reserved as 1
+// and 2 so pages can point at their parent before it's written.
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets []int
+	pages   []int
+	err     error
+}
+
+const (
+	pdfCatalog = 1
+	pdfPages   = 2
+)
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	p := &pdfWriter{w: bufio.NewWriter(w), offsets: make([]int, pdfPages)}
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return p
+}
+
+func (p *pdfWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.offset += n
+	p.err = err
+}
+
+func (p *pdfWriter) write(data []byte) {
+	if p.err != nil {
+		return
+	}
+
+	n, err := p.w.Write(data)
+	p.offset += n
+	p.err = err
+}
+
+// object starts a new object with the next free number, or with id if it's
+// one of the reserved ones.
+func (p *pdfWriter) object(id int) int {
+	if id == 0 {
+		p.offsets = append(p.offsets, 0)
+		id = len(p.offsets)
+	}
+	p.offsets[id-1] = p.offset
+	p.printf("%d 0 obj\n", id)
+
+	return id
+}
+
+func (p *pdfWriter) stream(dict string, data []byte) int {
+	id := p.object(0)
+	p.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	p.write(data)
+	p.printf("\nendstream\nendobj\n")
+
+	return id
+}
+
+// addImage adds a page sized to the image, at one PDF point per pixel.
+func (p *pdfWriter) addImage(img pdfImage) {
+	imageID := p.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s%s",
+		img.width, img.height, img.colorSpace, img.filter, img.extra), img.data)
+
+	content := fmt.Appendf(nil, "q %d 0 0 %d 0 0 cm /Im0 Do Q", img.width, img.height)
+	contentID := p.stream("", content)
+
+	pageID := p.object(0)
+	p.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+		pdfPages, img.width, img.height, imageID, contentID)
+	p.pages = append(p.pages, pageID)
+}
+
+// Close writes the page tree, catalog and cross-reference table.
+func (p *pdfWriter) Close() error {
+	kids := make([]string, len(p.pages))
+	for i, id := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+
+	p.object(pdfPages)
+	p.printf("<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(p.pages))
+	p.object(pdfCatalog)
+	p.printf("<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pdfPages)
+
+	xref := p.offset
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		p.printf("%010d 00000 n \n", offset)
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, pdfCatalog, xref)
+
+	if p.err != nil {
+		return p.err
+	}
+
+	return p.w.Flush()
+}
+
+// pdfImage is an image ready to be embedded as an XObject.
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	extra         string
+	data          []byte
+}
+
+// jpegImage embeds a JPEG as is, since PDF can decode it natively.
+func jpegImage(data []byte) (pdfImage, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, err
+	}
+
+	img := pdfImage{width: config.Width, height: config.Height, filter: "/DCTDecode", data: data}
+	switch config.ColorModel {
+	case color.GrayModel:
+		img.colorSpace = "/DeviceGray"
+	case color.CMYKModel:
+		// Adobe writes CMYK JPEGs inverted
+		img.colorSpace = "/DeviceCMYK"
+		img.extra = " /Decode [1 0 1 0 1 0 1 0]"
+	default:
+		img.colorSpace = "/DeviceRGB"
+	}
+
+	return img, nil
+}
+
+// rawImage decodes any other format and embeds its pixels as compressed
+// RGB, which drops transparency.
+func rawImage(data []byte) (pdfImage, error) {
+	decoded, _, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, err
+	}
+
+	bounds := decoded.Bounds()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 0, bounds.Dx()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(decoded.At(x, y)).(color.RGBA)
+			row = append(row, c.R, c.G, c.B)
+		}
+		if _, err := zw.Write(row); err != nil {
+			return pdfImage{}, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return pdfImage{}, err
+	}
+
+	return pdfImage{
+		width:      bounds.Dx(),
+		height:     bounds.Dy(),
+		colorSpace: "/DeviceRGB",
+		filter:     "/FlateDecode",
+		data:       buf.Bytes(),
+	}, nil
+}
+
+// writePDF writes imageFiles from pages to w as a PDF, one image per page,
+// and returns the number of pages written. Images that can't be decoded are
+// skipped with a warning rather than failing the whole book.
+func writePDF(w io.Writer, pages fs.FS, imageFiles []string) (int, error) {
+	p := newPDFWriter(w)
+
+	for _, name := range imageFiles {
+		data, err := fs.ReadFile(pages, name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		// by content, extensions can be missing or wrong
+		var img pdfImage
+		switch http.DetectContentType(data) {
+		case "image/jpeg":
+			img, err = jpegImage(data)
+		default:
+			img, err = rawImage(data)
+		}
+		if err != nil {
+			slog.Warn("Skipping page that can't be decoded", "file", name, "err", err)
+			continue
+		}
+
+		p.addImage(img)
+	}
+
+	return len(p.pages), p.Close()
+}
+
+// convertToPDF writes the pages of b to a PDF file at outputPath and
+// returns the number of pages written.
+func convertToPDF(b *book, outputPath string) (int, error) {
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := writePDF(outFile, b.pages, b.imageFiles)
+	if err != nil {
+		closeWithLog(outFile, "pdf")
+		removeAllWithLog(outputPath, "pdf")
+		return 0, err
+	}
+
+	return count, outFile.Close()
+}
@@ -0,0 +1,74 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertToPDF(t *testing.T) {
+	var photo bytes.Buffer
+	if err := jpeg.Encode(&photo, image.NewGray(image.Rect(0, 0, 6, 9)), nil); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := writeZip(t, []testEntry{
+		{name: "1.png", data: pngData(t, color.White)},
+		{name: "2.jpg", data: photo.String()},
+		{name: "3.png", data: "\x89PNG\r\n\x1a\n but not really"},
+		{name: "notes.txt", data: "not a page"},
+	})
+
+	outputPath := filepath.Join(t.TempDir(), "book.pdf")
+	count, err := ConvertToPDF(context.Background(), archivePath, outputPath, Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the broken page is skipped rather than failing the book
+	if count != 2 {
+		t.Errorf("%d pages written, want 2", count)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := string(data)
+
+	for _, want := range []string{
+		"%PDF-1.4\n",
+		"/Count 2 >>",
+		// each page is the size of its image
+		"/MediaBox [0 0 4 4]",
+		"/MediaBox [0 0 6 9]",
+		// the JPEG is embedded as it is, the PNG as pixels
+		"/Width 6 /Height 9 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode",
+		"/Width 4 /Height 4 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+		"%%EOF\n",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF doesn't contain %q", want)
+		}
+	}
+	if got := strings.Count(pdf, "/Type /Page /Parent"); got != 2 {
+		t.Errorf("PDF has %d pages, want 2", got)
+	}
+	if !bytes.Contains(data, photo.Bytes()) {
+		t.Error("PDF doesn't contain the JPEG as it was")
+	}
+
+	// readers find the objects through the cross-reference table
+	var xref int
+	if _, err := fmt.Sscanf(pdf[strings.LastIndex(pdf, "startxref\n"):], "startxref\n%d", &xref); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(pdf[xref:], "xref\n") {
+		t.Errorf("startxref points at %q, want the cross-reference table", pdf[xref:min(xref+10, len(pdf))])
+	}
+}
@@ -0,0 +1,96 @@
+package cbzopen
+
+import (
+	"context"
+	"sync"
+)
+
+// forEach calls fn for every index from 0 to n-1 on up to jobs goroutines.
+// Once a call fails no new ones are started, and the first error is
+// returned after the running ones finish.
+func forEach(n, jobs int, fn func(i int) error) error {
+	jobs = max(min(jobs, n), 1)
+
+	indexes := make(chan int)
+	stop := make(chan struct{})
+	var once sync.Once
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+					return
+				}
+			}
+		}()
+	}
+
+send:
+	for i := range n {
+		select {
+		case indexes <- i:
+		case <-stop:
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return firstErr
+}
+
+// limiter caps how many of something run at once, turning away the rest
+// instead of queueing them. A nil limiter lets everything through.
+type limiter chan struct{}
+
+func newLimiter(n int) limiter {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(limiter, n)
+}
+
+// tryAcquire takes a slot if one is free. Each successful call must be
+// followed by release.
+func (l limiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire waits for a slot, for work that can wait its turn. It fails only
+// if ctx is done first.
+func (l limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
@@ -0,0 +1,51 @@
+package cbzopen
+
+import (
+	"bufio"
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+//go:embed print.html.tmpl
+var printHTML string
+
+var printTemplate = sync.OnceValues(func() (*template.Template, error) {
+	return template.New("print.html.tmpl").Parse(printHTML)
+})
+
+type printData struct {
+	Title string
+	Pages []page
+}
+
+// servePrint handles /print, every page one after the other with nothing
+// around them, laid out so printing it puts each on a sheet of its own.
+// That's for saving the book as a PDF from the browser's print dialog.
+func (b *book) servePrint(w http.ResponseWriter, r *http.Request) {
+	tpl, err := printTemplate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := printData{Title: b.info.Title, Pages: make([]page, len(b.imageFiles))}
+	for i, name := range b.imageFiles {
+		data.Pages[i] = page{Number: i + 1, Name: name, URL: template.URL(pageURL(name))}
+		if width, height, err := pageSize(b.pages, name); err == nil {
+			data.Pages[i].Width, data.Pages[i].Height = width, height
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buffered := bufio.NewWriter(w)
+	err = tpl.Execute(buffered, data)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		slog.Error("Failed to render print view", "err", err)
+	}
+}
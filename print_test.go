@@ -0,0 +1,60 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServePrint(t *testing.T) {
+	page := pngData(t, color.White)
+	archivePath := writeZip(t, []testEntry{
+		{name: "10.png", data: page},
+		{name: "2.png", data: page},
+		{name: "a b.png", data: page},
+		{name: "ComicInfo.xml", data: "<ComicInfo><Title>The Book</Title></ComicInfo>"},
+	})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/print", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type %q, want text/html; charset=utf-8", got)
+	}
+
+	// every page in order, each on a sheet of its own, and none of the
+	// viewer around them
+	body := w.Body.String()
+	for _, want := range []string{"<title>The Book</title>", "@media print {", "break-after: page;", "break-inside: avoid;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("print view doesn't contain %s", want)
+		}
+	}
+	last := 0
+	for _, img := range []string{
+		`<img src="2.png" alt="2.png" width="4" height="4">`,
+		`<img src="10.png" alt="10.png" width="4" height="4">`,
+		`<img src="a%20b.png" alt="a b.png" width="4" height="4">`,
+	} {
+		i := strings.Index(body, img)
+		if i < last {
+			t.Errorf("print view doesn't have %s after the pages before it", img)
+		}
+		last = i
+	}
+	for _, notWant := range []string{"<script", "<button"} {
+		if strings.Contains(body, notWant) {
+			t.Errorf("print view contains %s", notWant)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cbzopen
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//go:embed service-worker.js
+var serviceWorker string
+
+// webManifest is what browsers need to install the viewer as an app. The
+// URLs are relative to the manifest, so it works for books in a library too.
+type webManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	StartURL        string         `json:"start_url"`
+	Scope           string         `json:"scope"`
+	Display         string         `json:"display"`
+	BackgroundColor string         `json:"background_color"`
+	ThemeColor      string         `json:"theme_color"`
+	Icons           []manifestIcon `json:"icons"`
+}
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+func (b *book) serveManifest(w http.ResponseWriter, r *http.Request) {
+	manifest := webManifest{
+		Name:            b.info.Title,
+		ShortName:       b.info.Title,
+		StartURL:        "./",
+		Scope:           "./",
+		Display:         "standalone",
+		BackgroundColor: "#222222",
+		ThemeColor:      "#222222",
+		Icons:           []manifestIcon{{Src: "/favicon.ico", Sizes: "32x32", Type: "image/x-icon"}},
+	}
+
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(manifest); err != nil {
+		slog.Error("Failed to write web app manifest", "err", err)
+	}
+}
+
+// serveServiceWorker sends service-worker.js with the name of the cache for
+// this book in front of it.
+func (b *book) serveServiceWorker(w http.ResponseWriter, r *http.Request) {
+	sum := sha256.Sum256([]byte(b.path + "\n" + strings.Join(b.imageFiles, "\n")))
+	cacheName := "cbzopen-" + hex.EncodeToString(sum[:8])
+
+	w.Header().Set("Content-Type", "text/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write([]byte("const cacheName = " + strconv.Quote(cacheName) + ";\n\n" + serviceWorker))
+}
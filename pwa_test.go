@@ -0,0 +1,66 @@
+package cbzopen
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeManifest(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{
+		{name: "1.png", data: pngData(t, color.White)},
+		{name: "ComicInfo.xml", data: "<ComicInfo><Title>The Book</Title></ComicInfo>"},
+	})
+
+	for _, pwa := range []bool{false, true} {
+		b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir(), PWA: pwa}.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		want := http.StatusNotFound
+		if pwa {
+			want = http.StatusOK
+		}
+
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/manifest.webmanifest", nil))
+		if w.Code != want {
+			t.Fatalf("pwa %t: manifest status %d, want %d", pwa, w.Code, want)
+		}
+		if pwa {
+			if got := w.Header().Get("Content-Type"); got != "application/manifest+json" {
+				t.Errorf("Content-Type %q, want application/manifest+json", got)
+			}
+			var manifest webManifest
+			if err := json.NewDecoder(w.Body).Decode(&manifest); err != nil {
+				t.Fatalf("manifest isn't JSON: %v", err)
+			}
+			// relative, so a book in a library starts where it was installed
+			if manifest.Name != "The Book" || manifest.StartURL != "./" {
+				t.Errorf("name %q and start_url %q, want The Book and ./", manifest.Name, manifest.StartURL)
+			}
+		}
+
+		w = httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/service-worker.js", nil))
+		if w.Code != want {
+			t.Fatalf("pwa %t: service worker status %d, want %d", pwa, w.Code, want)
+		}
+		if pwa && !strings.HasPrefix(w.Body.String(), `const cacheName = "cbzopen-`) {
+			t.Errorf("service worker starts %.40q, want the cache name", w.Body.String())
+		}
+	}
+}
+
+func TestIndexPWA(t *testing.T) {
+	checkIndex(t, []indexTest{
+		{name: "off", want: []string{`data-pwa="false"`}, notWant: []string{`<link rel="manifest"`}},
+		{name: "on", opts: viewerOptions{PWA: true}, want: []string{`data-pwa="true"`, `<link rel="manifest" href="manifest.webmanifest">`}},
+	})
+}
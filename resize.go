@@ -0,0 +1,392 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbnailWidth = 200
+	// maxResizeWidth caps /resize requests so nobody can make us allocate
+	// enormous images
+	maxResizeWidth = 4096
+	// resizeWidthStep is what /resize widths must be a multiple of, so the
+	// cache holds a few sizes of each page rather than thousands
+	resizeWidthStep = 100
+	// maxThumbnailCache is how big the thumbnail cache may grow before the
+	// thumbnails used least recently are removed
+	maxThumbnailCache = 256 * MiB
+)
+
+// errBusy is returned when as many images as the limiter allows are already
+// being resized or converted.
+var errBusy = errors.New("too many images being transformed")
+
+// tooBusy tells the client to try again shortly.
+func tooBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "busy, try again shortly", http.StatusTooManyRequests)
+}
+
+// resizer serves downscaled copies of pages, both as thumbnails for the grid
+// and through the /resize endpoint. Each size of a page is generated on
+// first request and cached in dir, or made again every time if dir is "".
+// Thumbnails go in cacheDir instead when it's set, which outlives the book.
+// Only the book's pages are resized, and no more than limit at once.
+type resizer struct {
+	pages    fs.FS
+	dir      string
+	cacheDir string
+	known    map[string]bool
+	limit    limiter
+
+	// sums memoizes the hashes naming pages in cacheDir, so each page is
+	// read through once rather than on every request
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+// ServeHTTP handles /resize?file=page1.jpg&w=800.
+func (rs *resizer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// written plainly, so "+800" or "0800" can't stand in for 800
+	w := query.Get("w")
+	width, err := strconv.Atoi(w)
+	if err != nil || strconv.Itoa(width) != w || width <= 0 || width > maxResizeWidth || width%resizeWidthStep != 0 {
+		http.Error(rw, fmt.Sprintf("w must be a multiple of %d up to %d", resizeWidthStep, maxResizeWidth), http.StatusBadRequest)
+		return
+	}
+
+	rs.serveResized(rw, r, query.Get("file"), width, false)
+}
+
+// thumbnails handles /thumbs/<page>, with the prefix already stripped. The
+// grid asks for lots of them at once, so when too many are being made the
+// full page is sent instead of turning the browser away.
+func (rs *resizer) thumbnails() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.serveResized(w, r, strings.TrimPrefix(r.URL.Path, "/"), thumbnailWidth, true)
+	})
+}
+
+// serveResized sends the page name scaled down to width. If the limiter is
+// full it answers 429, or with the full page if fullWhenBusy is set.
+func (rs *resizer) serveResized(w http.ResponseWriter, r *http.Request, name string, width int, fullWhenBusy bool) {
+	if !rs.known[name] {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := rs.sendResized(w, r, name, width)
+	if errors.Is(err, errBusy) && !fullWhenBusy {
+		tooBusy(w)
+		return
+	}
+	if err != nil {
+		// fall back to the full image, the browser may still be able to show
+		// formats we can't decode
+		if !errors.Is(err, errBusy) {
+			slog.Warn("Failed to resize page", "file", name, "err", err)
+		}
+		http.ServeFileFS(w, r, rs.pages, name)
+	}
+}
+
+// sendResized sends name scaled down to width. Nothing is written to w if it
+// fails.
+func (rs *resizer) sendResized(w http.ResponseWriter, r *http.Request, name string, width int) error {
+	if rs.dir == "" {
+		var resized bytes.Buffer
+		ext := resizedExt(name)
+		if err := rs.encodeResized(&resized, name, width, ext); err != nil {
+			return err
+		}
+
+		http.ServeContent(w, r, "resized"+ext, time.Time{}, bytes.NewReader(resized.Bytes()))
+		return nil
+	}
+
+	resizedPath, err := rs.resized(name, width)
+	if err != nil {
+		return err
+	}
+
+	http.ServeFile(w, r, resizedPath)
+	return nil
+}
+
+// resizedExt keeps png as png so transparency survives, everything else
+// becomes jpeg.
+func resizedExt(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".png") {
+		return ".png"
+	}
+
+	return ".jpg"
+}
+
+// encodeResized decodes name, scales it to width and writes it to w in the
+// format for ext. It returns errBusy if the limiter is full.
+func (rs *resizer) encodeResized(w io.Writer, name string, width int, ext string) error {
+	if !rs.limit.tryAcquire() {
+		return errBusy
+	}
+	defer rs.limit.release()
+
+	return rs.encode(w, name, width, ext)
+}
+
+// encode is encodeResized without the limiter, for callers that hold a
+// slot already.
+func (rs *resizer) encode(w io.Writer, name string, width int, ext string) error {
+	f, err := rs.pages.Open(name)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(f, "page")
+
+	img, _, err := decodeImage(f)
+	if err != nil {
+		return err
+	}
+	img = scaleToWidth(img, width)
+
+	if ext == ".png" {
+		return png.Encode(w, img)
+	}
+
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 80})
+}
+
+func (rs *resizer) resized(name string, width int) (string, error) {
+	resizedPath, err := rs.resizedPath(name, width)
+	if err != nil {
+		return "", err
+	}
+
+	if rs.isCached(resizedPath) {
+		return resizedPath, nil
+	}
+
+	if err := rs.writeResized(resizedPath, name, width, rs.encodeResized); err != nil {
+		return "", err
+	}
+
+	return resizedPath, nil
+}
+
+// resizedPath is where the copy of name scaled to width is cached. In
+// cacheDir, thumbnails are named by the hash of the page's bytes rather
+// than its name, so the same page is found again whichever archive it's
+// read from, and one that changed is made again.
+func (rs *resizer) resizedPath(name string, width int) (string, error) {
+	ext := resizedExt(name)
+
+	if rs.cacheDir != "" && width == thumbnailWidth {
+		sum, err := rs.pageSum(name)
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(rs.cacheDir, fmt.Sprintf("%s-%d%s", sum, width, ext)), nil
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(rs.dir, fmt.Sprintf("%s-%d%s", hex.EncodeToString(sum[:]), width, ext)), nil
+}
+
+// pageSum returns the hex sha256 of name's bytes, hashing it only the first
+// time. Pages don't change while the book is open.
+func (rs *resizer) pageSum(name string) (string, error) {
+	rs.mu.Lock()
+	sum, ok := rs.sums[name]
+	rs.mu.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	f, err := rs.pages.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer closeWithLog(f, "page")
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	sum = hex.EncodeToString(hash.Sum(nil))
+
+	rs.mu.Lock()
+	if rs.sums == nil {
+		rs.sums = make(map[string]string)
+	}
+	rs.sums[name] = sum
+	rs.mu.Unlock()
+
+	return sum, nil
+}
+
+// isCached reports whether resizedPath has been made already. Thumbnails
+// found in cacheDir are marked as just used, which trimThumbnailCache goes
+// by.
+func (rs *resizer) isCached(resizedPath string) bool {
+	if _, err := os.Stat(resizedPath); err != nil {
+		return false
+	}
+
+	if rs.cacheDir != "" && filepath.Dir(resizedPath) == rs.cacheDir {
+		now := time.Now()
+		if err := os.Chtimes(resizedPath, now, now); err != nil {
+			slog.Debug("Failed to mark thumbnail as used", "file", resizedPath, "err", err)
+		}
+	}
+
+	return true
+}
+
+// writeResized writes name scaled to width to resizedPath with encode.
+func (rs *resizer) writeResized(resizedPath, name string, width int, encode func(w io.Writer, name string, width int, ext string) error) error {
+	// write to a temporary file first so a concurrent request never serves a
+	// half written image
+	tmpFile, err := os.CreateTemp(filepath.Dir(resizedPath), "resize-")
+	if err != nil {
+		return err
+	}
+
+	err = encode(tmpFile, name, width, resizedExt(name))
+	closeWithLog(tmpFile, "resized image")
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), resizedPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return nil
+}
+
+// warmThumbnails makes the thumbnails of names that aren't cached yet
+// ahead of time, a few at once, so the grid doesn't wait for them. Each
+// waits for a slot of the limiter, and it gives up once ctx is done.
+func (rs *resizer) warmThumbnails(ctx context.Context, names []string) {
+	start := time.Now()
+	var made atomic.Int64
+	err := forEach(len(names), warmJobs(), func(i int) error {
+		name := names[i]
+		resizedPath, err := rs.resizedPath(name, thumbnailWidth)
+		if err != nil {
+			slog.Debug("Failed to make thumbnail", "file", name, "err", err)
+			return ctx.Err()
+		}
+		if rs.isCached(resizedPath) {
+			return ctx.Err()
+		}
+
+		if err := rs.limit.acquire(ctx); err != nil {
+			return err
+		}
+		defer rs.limit.release()
+
+		if err := rs.writeResized(resizedPath, name, thumbnailWidth, rs.encode); err != nil {
+			slog.Debug("Failed to make thumbnail", "file", name, "err", err)
+		} else {
+			made.Add(1)
+		}
+
+		return ctx.Err()
+	})
+	if err == nil && made.Load() > 0 {
+		slog.Debug("Made thumbnails", "count", made.Load(), "duration", time.Since(start))
+	}
+}
+
+// trimThumbnailCache removes the thumbnails in dir used least recently
+// until the rest fit in maxSize. Half written ones are left alone.
+func trimThumbnailCache(dir string, maxSize ByteSize) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("Failed to trim thumbnail cache", "dir", dir, "err", err)
+		return
+	}
+
+	var thumbnails []fs.FileInfo
+	var total int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), "resize-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		thumbnails = append(thumbnails, info)
+		total += info.Size()
+	}
+
+	slices.SortFunc(thumbnails, func(a, b fs.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	removed := 0
+	for _, info := range thumbnails {
+		if total <= int64(maxSize) {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			slog.Debug("Failed to remove thumbnail", "file", info.Name(), "err", err)
+			continue
+		}
+		total -= info.Size()
+		removed++
+	}
+	if removed > 0 {
+		slog.Debug("Trimmed thumbnail cache", "dir", dir, "removed", removed)
+	}
+}
+
+// warmJobs is how many thumbnails warmThumbnails makes at once, half the
+// CPUs so there's room left for the pages being read.
+func warmJobs() int {
+	return max(runtime.GOMAXPROCS(0)/2, 1)
+}
+
+// scaleToWidth shrinks img to the given width, preserving its aspect ratio.
+// Images that are already narrow enough are returned as is.
+func scaleToWidth(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, width, max(height, 1)))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return dst
+}
@@ -0,0 +1,290 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachedThumbnails returns how many files are in the thumbnail cache dir.
+func cachedThumbnails(t *testing.T, dir string) int {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(entries)
+}
+
+func TestWarmOnlyWhenServing(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	opts := Options{TempDir: t.TempDir(), ThumbnailCache: t.TempDir()}
+
+	// books opened for anything but reading, like -to-pdf or a library's,
+	// leave the cache alone
+	b, err := openBook(context.Background(), archivePath, opts.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if n := cachedThumbnails(t, opts.ThumbnailCache); n != 0 {
+		t.Fatalf("opening a book cached %d thumbnails, want none", n)
+	}
+
+	s, err := NewServer(context.Background(), archivePath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for cachedThumbnails(t, opts.ThumbnailCache) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("serving a book didn't cache its thumbnail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestThumbnailCacheHit(t *testing.T) {
+	page := pngData(t, color.White)
+	opts := Options{TempDir: t.TempDir(), ThumbnailCache: t.TempDir()}.book()
+
+	thumbnail := func(archivePath string) string {
+		t.Helper()
+
+		b, err := openBook(context.Background(), archivePath, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		w := httptest.NewRecorder()
+		b.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/thumbs/1.png", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("/thumbs/1.png: status %d", w.Code)
+		}
+
+		return w.Body.String()
+	}
+
+	thumbnail(writeZip(t, []testEntry{{name: "1.png", data: page}}))
+	cached, err := filepath.Glob(filepath.Join(opts.thumbnailCache, "*.png"))
+	if err != nil || len(cached) != 1 {
+		t.Fatalf("cached %v (%v), want one thumbnail", cached, err)
+	}
+
+	// the same page in another archive is served from the cache, which is
+	// marked so it can't have been made again
+	if err := os.WriteFile(cached[0], []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := thumbnail(writeZip(t, []testEntry{{name: "1.png", data: page}, {name: "2.png", data: page}})); got != "cached" {
+		t.Errorf("second run made the thumbnail again instead of using the cache")
+	}
+}
+
+func TestTrimThumbnailCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"old.png", "used.png", "new.png", "resize-123"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i-10) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the two used most recently fit, the one being written is left alone
+	trimThumbnailCache(dir, 250)
+
+	for name, want := range map[string]bool{"old.png": false, "used.png": true, "new.png": true, "resize-123": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s kept = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	// a GIF header claiming 65535x65535, a few bytes that would otherwise
+	// have us allocate 16GiB
+	huge := "GIF89a\xff\xff\xff\xff\x00\x00\x00"
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"small", pngData(t, color.White), nil},
+		{"huge", huge, errImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		_, _, err := decodeImage(strings.NewReader(tt.data))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: decodeImage: %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// widePage returns a white PNG 400 pixels wide and 100 high.
+func widePage(t *testing.T) string {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 400, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	var page bytes.Buffer
+	if err := png.Encode(&page, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return page.String()
+}
+
+// imageSize decodes data and returns its width and height.
+func imageSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding %d bytes: %v", len(data), err)
+	}
+
+	return config.Width, config.Height
+}
+
+func TestThumbnails(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "wide.png", data: widePage(t)}, {name: "small.png", data: pngData(t, color.White)}})
+
+	// with a temp dir and in memory, where they're made every time
+	for _, opts := range []Options{{}, {InMemory: true}} {
+		opts.TempDir = t.TempDir()
+		b, err := openBook(context.Background(), archivePath, opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		tests := []struct {
+			path          string
+			want          int
+			width, height int
+		}{
+			{path: "/thumbs/wide.png", want: http.StatusOK, width: thumbnailWidth, height: 50},
+			// pages narrower than a thumbnail stay as they are
+			{path: "/thumbs/small.png", want: http.StatusOK, width: 4, height: 4},
+			{path: "/thumbs/missing.png", want: http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("in memory %v: %s: status %d, want %d", opts.InMemory, tt.path, w.Code, tt.want)
+				continue
+			}
+			if tt.want != http.StatusOK {
+				continue
+			}
+			if width, height := imageSize(t, w.Body.Bytes()); width != tt.width || height != tt.height {
+				t.Errorf("in memory %v: %s is %dx%d, want %dx%d", opts.InMemory, tt.path, width, height, tt.width, tt.height)
+			}
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "wide.png", data: widePage(t)}})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	tests := []struct {
+		query         string
+		want          int
+		width, height int
+	}{
+		{query: "file=wide.png&w=100", want: http.StatusOK, width: 100, height: 25},
+		{query: "file=wide.png&w=300", want: http.StatusOK, width: 300, height: 75},
+		// the page is smaller than asked for
+		{query: "file=wide.png&w=800", want: http.StatusOK, width: 400, height: 100},
+		{query: "file=wide.png&w=150", want: http.StatusBadRequest},
+		{query: "file=wide.png&w=0", want: http.StatusBadRequest},
+		{query: "file=wide.png&w=%2B800", want: http.StatusBadRequest},
+		{query: "file=wide.png&w=0800", want: http.StatusBadRequest},
+		{query: "file=wide.png&w=4100", want: http.StatusBadRequest},
+		{query: "file=wide.png", want: http.StatusBadRequest},
+		{query: "file=missing.png&w=100", want: http.StatusNotFound},
+		{query: "file=../wide.png&w=100", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resize?"+tt.query, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.query, w.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		if width, height := imageSize(t, w.Body.Bytes()); width != tt.width || height != tt.height {
+			t.Errorf("%s: resized to %dx%d, want %dx%d", tt.query, width, height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestResizeLimit(t *testing.T) {
+	page := widePage(t)
+	archivePath := writeZip(t, []testEntry{{name: "wide.png", data: page}})
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir(), TransformJobs: 1}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// another page is being resized, taking the only slot
+	if !b.resizer.limit.tryAcquire() {
+		t.Fatal("no free slot to start with")
+	}
+
+	w := get("/resize?file=wide.png&w=100")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("resizing while busy: status %d with Retry-After %q, want %d with one", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	// thumbnails fall back to the full page instead
+	if w := get("/thumbs/wide.png"); w.Code != http.StatusOK || w.Body.String() != page {
+		t.Errorf("thumbnail while busy: status %d with %d bytes, want %d with the full page", w.Code, w.Body.Len(), http.StatusOK)
+	}
+
+	b.resizer.limit.release()
+	if w := get("/resize?file=wide.png&w=100"); w.Code != http.StatusOK {
+		t.Errorf("resizing once free: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
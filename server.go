@@ -0,0 +1,351 @@
+package cbzopen
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Server serves a book, or a library of them, over HTTP.
+type Server struct {
+	// mu guards content and pageCount, which change when a watched book is
+	// reloaded; content is nil once s is closed
+	mu        sync.RWMutex
+	content   *content
+	pageCount int
+	isLibrary bool
+
+	// stopWatch and watchDone are set while watching the book for changes
+	stopWatch context.CancelFunc
+	watchDone chan struct{}
+	// events tells viewers to refresh after the book is reloaded
+	events *events
+
+	user, pass string
+	accessLog  bool
+
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewServer opens the archive, image directory or directory of archives at
+// path for serving. Close or Shutdown releases what it puts on disk. Opening
+// an archive that needs extracting stops early if ctx is done.
+func NewServer(ctx context.Context, path string, opts Options) (*Server, error) {
+	s := &Server{isLibrary: IsLibrary(path), events: newEvents()}
+
+	// a directory is served as a library of the archives in it, unless it's
+	// just a folder of images
+	if s.isLibrary {
+		// books in a library aren't watched, so their viewers have nothing
+		// to listen for
+		bookOpts := opts.book()
+		bookOpts.viewer.Watch = false
+
+		l, err := openLibrary(path, bookOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Info("Opened library", "file", path, "archiveCount", len(l.names))
+		s.content = newContent(l)
+	} else {
+		b, err := openBook(ctx, path, opts.book())
+		if err != nil {
+			return nil, err
+		}
+
+		s.pageCount = len(b.imageFiles)
+		slog.Info("Opened book", "file", path, "pageCount", s.pageCount)
+		b.warmThumbnails()
+		s.content = newContent(b)
+	}
+
+	if opts.Watch {
+		if s.isLibrary {
+			slog.Warn("-watch is not supported for libraries", "file", path)
+		} else if err := s.watch(ctx, path, opts.book()); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// NewSessionServer is like NewServer for several archives read one after
+// the other as a single book, like the chapters of a volume. Turning past the
+// last page of one goes on to the first page of the next. A single path is
+// opened as NewServer would.
+func NewSessionServer(ctx context.Context, paths []string, opts Options) (*Server, error) {
+	if len(paths) == 1 {
+		return NewServer(ctx, paths[0], opts)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no archives to open")
+	}
+
+	if opts.Watch {
+		slog.Warn("-watch is not supported when reading several archives together")
+	}
+
+	// there's nothing watching for the viewer to listen to
+	bookOpts := opts.book()
+	bookOpts.viewer.Watch = false
+
+	b, err := openSession(ctx, paths, bookOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	b.warmThumbnails()
+	s := &Server{content: newContent(b), pageCount: len(b.imageFiles), events: newEvents()}
+	slog.Info("Opened session", "archiveCount", len(paths), "pageCount", s.pageCount)
+
+	return s, nil
+}
+
+// PageCount returns the number of pages in the book, or 0 for a library.
+func (s *Server) PageCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pageCount
+}
+
+// IsLibrary reports whether s serves a directory of archives.
+func (s *Server) IsLibrary() bool {
+	return s.isLibrary
+}
+
+// RequireAuth makes s require HTTP Basic Auth with the given credentials.
+// It must be called before Start.
+func (s *Server) RequireAuth(user, pass string) {
+	s.user, s.pass = user, pass
+}
+
+// LogRequests makes s log every request it answers. It must be called
+// before Start.
+func (s *Server) LogRequests() {
+	s.accessLog = true
+}
+
+// Addr returns the address s is listening on, once started.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/favicon.ico":
+		serveFavicon(w, r)
+		return
+	case "/events":
+		s.events.ServeHTTP(w, r)
+		return
+	}
+
+	// counted in while still holding the lock, so a reload that swapped
+	// the content out sees every request that got hold of it
+	s.mu.RLock()
+	content := s.content
+	if content != nil {
+		content.requests.Add(1)
+	}
+	s.mu.RUnlock()
+	if content == nil {
+		http.Error(w, "server is closed", http.StatusServiceUnavailable)
+		return
+	}
+	defer content.requests.Done()
+
+	content.ServeHTTP(w, r)
+}
+
+// content is the book or library a Server serves, with the requests using
+// it counted, so a book replaced by a reload is only closed once they're
+// done with it.
+type content struct {
+	handler  contentHandler
+	requests sync.WaitGroup
+}
+
+// contentHandler is a book or a library.
+type contentHandler interface {
+	http.Handler
+	Close()
+}
+
+func newContent(handler contentHandler) *content {
+	return &content{handler: handler}
+}
+
+func (c *content) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handler.ServeHTTP(w, r)
+}
+
+// Close waits for the requests still using c, then closes it.
+func (c *content) Close() {
+	c.requests.Wait()
+	c.handler.Close()
+}
+
+type health struct {
+	Status    string `json:"status"`
+	PageCount int    `json:"pageCount"`
+}
+
+// withHealth answers /healthz before next, and so before any auth, since
+// it's asked by supervisors and load balancers that don't have the password.
+func withHealth(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			s.serveHealth(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveHealth reports that the book is open and its viewer written, which it
+// always is by the time s serves anything until it's closed, as a small JSON
+// body.
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	ready := s.content != nil
+	pageCount := s.pageCount
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(health{Status: "closed"})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(health{Status: "ok", PageCount: pageCount}); err != nil {
+		slog.Error("Failed to write health", "err", err)
+	}
+}
+
+// Start listens on addr and serves in the background. If certFile and
+// keyFile are both given it serves HTTPS, failing before it listens if they
+// can't be loaded.
+func (s *Server) Start(addr, certFile, keyFile string) error {
+	tlsConfig, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.serve(listener, tlsConfig)
+	return nil
+}
+
+// Serve is like Start, using an existing listener, which is left open if
+// the certificate can't be loaded.
+func (s *Server) Serve(listener net.Listener, certFile, keyFile string) error {
+	tlsConfig, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	s.serve(listener, tlsConfig)
+	return nil
+}
+
+// loadTLSConfig loads the certificate for serving HTTPS, or returns nil for
+// plain HTTP if certFile and keyFile aren't both given.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+func (s *Server) serve(listener net.Listener, tlsConfig *tls.Config) {
+	s.listener = listener
+
+	handler := compress(s)
+	if s.user != "" {
+		handler = basicAuth(handler, s.user, s.pass)
+	}
+	handler = withHealth(s, handler)
+	if s.accessLog {
+		handler = logRequests(handler)
+	}
+	s.server = &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	s.server.RegisterOnShutdown(s.events.close)
+
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// the certificate is already in TLSConfig
+			err = s.server.ServeTLS(listener, "", "")
+		} else {
+			err = s.server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server error", "err", err)
+		}
+	}()
+}
+
+// Shutdown stops the server, waiting for open connections until ctx is
+// done and then cutting off whatever is left, and closes the book. It
+// returns the context's error if connections had to be cut off.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.Close()
+
+	if s.server == nil {
+		return nil
+	}
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		_ = s.server.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Close removes everything s put on disk, without stopping the server.
+func (s *Server) Close() {
+	if s.stopWatch != nil {
+		s.stopWatch()
+		<-s.watchDone
+	}
+
+	// taken out under the lock like a reload does, so no request can be
+	// counted in while Close waits for the ones already in
+	s.mu.Lock()
+	content := s.content
+	s.content = nil
+	s.mu.Unlock()
+
+	if content != nil {
+		content.Close()
+	}
+}
@@ -0,0 +1,255 @@
+package cbzopen
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"image/color"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServerCloseWhileServing(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	s, err := NewServer(context.Background(), archivePath, Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requests keep coming in until they find s closed
+	started := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pages", nil))
+				once.Do(func() { close(started) })
+				if w.Code == http.StatusServiceUnavailable {
+					return
+				}
+				if w.Code != http.StatusOK {
+					t.Errorf("status %d while serving", w.Code)
+					return
+				}
+			}
+		}()
+	}
+
+	<-started
+	s.Close()
+	wg.Wait()
+
+	// closing again is harmless
+	s.Close()
+
+	w := httptest.NewRecorder()
+	withHealth(s, s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("health after closing: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key, and
+// returns their paths.
+func writeCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestStartTLS(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+	certFile, keyFile := writeCert(t)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+		scheme            string
+		wantErr           bool
+	}{
+		{name: "plain", scheme: "http"},
+		// both are needed for HTTPS
+		{name: "cert only", certFile: certFile, scheme: "http"},
+		{name: "tls", certFile: certFile, keyFile: keyFile, scheme: "https"},
+		{name: "key as cert", certFile: keyFile, keyFile: keyFile, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s, err := NewServer(context.Background(), archivePath, Options{TempDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Start("127.0.0.1:0", tt.certFile, tt.keyFile)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: Start succeeded, want an error", tt.name)
+				_ = s.Shutdown(context.Background())
+			} else {
+				s.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		resp, err := client.Get(tt.scheme + "://" + s.Addr().String() + "/api/pages")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else {
+			closeWithLog(resp.Body, "response")
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%s: status %d", tt.name, resp.StatusCode)
+			}
+		}
+
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: pngData(t, color.White)}})
+
+	tests := []struct {
+		name string
+		// halfRequest leaves a request half sent, holding its connection
+		halfRequest bool
+		want        error
+	}{
+		{name: "idle", want: nil},
+		{name: "request in flight", halfRequest: true, want: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		s, err := NewServer(context.Background(), archivePath, Options{TempDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Start("127.0.0.1:0", "", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		var conn net.Conn
+		if tt.halfRequest {
+			conn, err = net.Dial("tcp", s.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeWithLog(conn, "connection")
+			if _, err := conn.Write([]byte("GET /api/pages HTTP/1.1\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			// give the server time to start reading it
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		err = s.Shutdown(ctx)
+		cancel()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Shutdown: %v, want %v", tt.name, err, tt.want)
+		}
+
+		// the connection held open is cut off rather than left hanging
+		if conn != nil {
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) && !errors.Is(err, syscall.ECONNRESET) {
+				t.Errorf("%s: reading after Shutdown: %v, want the connection closed", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	page := pngData(t, color.White)
+	archivePath := writeZip(t, []testEntry{{name: "1.png", data: page}, {name: "2.png", data: page}})
+	s, err := NewServer(context.Background(), archivePath, Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// supervisors ask without the password
+	s.RequireAuth("reader", "secret")
+	if err := s.Start("127.0.0.1:0", "", ""); err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Shutdown(context.Background()) }()
+	url := "http://" + s.Addr().String()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeWithLog(resp.Body, "response")
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := get("/"); code != http.StatusUnauthorized {
+		t.Errorf("viewer: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, body := get("/healthz"); code != http.StatusOK || body != `{"status":"ok","pageCount":2}`+"\n" {
+		t.Errorf("open: status %d with %q, want %d with the page count", code, body, http.StatusOK)
+	}
+
+	// once closed, it's not ready to serve the book any more
+	s.Close()
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || body != `{"status":"closed","pageCount":0}`+"\n" {
+		t.Errorf("closed: status %d with %q, want %d", code, body, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,54 @@
+// The service worker for -pwa keeps the open book readable offline. cacheName
+// is put in front of this script by the server, and changes with the book, so
+// another book served on the same port starts with a fresh cache.
+
+self.addEventListener("install", function (event) {
+    self.skipWaiting();
+
+    // fetch every page ahead of time, a page that fails is just left out
+    event.waitUntil(caches.open(cacheName).then(async function (cache) {
+        await cache.add("./");
+        const response = await fetch("api/pages");
+        const list = await response.json();
+        await Promise.all(list.pages.map(function (page) {
+            return cache.add(page.url).catch(function () {});
+        }));
+    }));
+});
+
+self.addEventListener("activate", function (event) {
+    event.waitUntil(caches.keys().then(function (names) {
+        return Promise.all(names.filter(function (name) {
+            return name.startsWith("cbzopen-") && name !== cacheName;
+        }).map(function (name) {
+            return caches.delete(name);
+        }));
+    }).then(function () {
+        return self.clients.claim();
+    }));
+});
+
+// the network comes first so nothing goes stale while the server is up; the
+// cache only answers once it's gone. The API, events and downloads are left
+// to the browser
+self.addEventListener("fetch", function (event) {
+    const url = new URL(event.request.url);
+    const path = url.pathname.slice(new URL(self.registration.scope).pathname.length);
+    if (event.request.method !== "GET" || /^(api\/|events|download)/.test(path)) {
+        return;
+    }
+
+    event.respondWith(fetch(event.request).then(function (response) {
+        if (response.ok) {
+            const copy = response.clone();
+            caches.open(cacheName).then(function (cache) {
+                return cache.put(event.request, copy);
+            });
+        }
+        return response;
+    }).catch(function () {
+        return caches.match(event.request, {ignoreVary: true}).then(function (cached) {
+            return cached || Response.error();
+        });
+    }));
+});
@@ -0,0 +1,90 @@
+package cbzopen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// openSession opens several archives as one book, read one after the other
+// like chapters. Each is extracted into its own numbered folder of a temp
+// dir, and the pages are listed archive by archive in the order given.
+func openSession(ctx context.Context, archivePaths []string, opts bookOptions) (*book, error) {
+	// a session can't be opened again as it was, so there's nothing to
+	// resume or bookmark
+	opts.pageViewed = nil
+	opts.bookmarks = nil
+	opts.viewer.Bookmarks = false
+
+	b := &book{path: archivePaths[0]}
+	if err := b.openSession(ctx, archivePaths, opts); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *book) openSession(ctx context.Context, archivePaths []string, opts bookOptions) error {
+	tempDir, err := b.makeTempDir(opts)
+	if err != nil {
+		return err
+	}
+
+	var titles []string
+	for i, archivePath := range archivePaths {
+		fileInfo, err := os.Stat(archivePath)
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() {
+			return fmt.Errorf("%s is a directory, only archives can be read together", archivePath)
+		}
+
+		// numbered rather than named, so two archives with the same name
+		// don't end up in the same folder
+		folder := strconv.Itoa(i + 1)
+		dir := filepath.Join(tempDir, folder)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+
+		slog.Info("Extracting archive", "file", archivePath, "dir", dir)
+		if err := extractPages(ctx, archivePath, dir, opts); err != nil {
+			return fmt.Errorf("%s: %w", archivePath, err)
+		}
+
+		names, err := listFiles(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read directory: %w", err)
+		}
+		dirFS := os.DirFS(dir)
+		info := readComicInfo(dirFS, archivePath)
+		for _, name := range orderPages(imagePagesFS(dirFS, names, opts.extensions, opts.order), info) {
+			b.imageFiles = append(b.imageFiles, folder+"/"+name)
+		}
+
+		titles = append(titles, info.Title)
+	}
+
+	b.info = comicInfo{Title: strings.Join(titles, ", ")}
+
+	f, err := os.Create(filepath.Join(tempDir, "index.html"))
+	if err != nil {
+		return fmt.Errorf("failed to create index.html: %w", err)
+	}
+	defer closeWithLog(f, "index.html")
+
+	b.imageFiles = omitRepeats(os.DirFS(tempDir), b.imageFiles, opts.viewer)
+	if err := writeIndexHTML(f, os.DirFS(tempDir), b.imageFiles, b.info, opts.viewer); err != nil {
+		return fmt.Errorf("failed to create index.html: %w", err)
+	}
+
+	b.pages = os.DirFS(tempDir)
+
+	return b.serve(opts)
+}
@@ -0,0 +1,60 @@
+package cbzopen
+
+import (
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestOpenSession(t *testing.T) {
+	white, black := pngData(t, color.White), pngData(t, color.Black)
+	// given out of name order, and with pages of the same name
+	second := writeZip(t, []testEntry{{name: "2.png", data: black}, {name: "1.png", data: black}})
+	first := writeZip(t, []testEntry{
+		{name: "10.png", data: white},
+		{name: "2.png", data: white},
+		{name: "ComicInfo.xml", data: "<ComicInfo><Title>Chapter 1</Title></ComicInfo>"},
+	})
+
+	b, err := openSession(context.Background(), []string{first, second}, Options{TempDir: t.TempDir()}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// the pages of each archive in turn, in the order they were given
+	if want := []string{"1/2.png", "1/10.png", "2/1.png", "2/2.png"}; !slices.Equal(b.imageFiles, want) {
+		t.Errorf("pages %q, want %q", b.imageFiles, want)
+	}
+	if want := "Chapter 1, book"; b.info.Title != want {
+		t.Errorf("title %q, want %q", b.info.Title, want)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/1/2.png", want: white},
+		{path: "/2/2.png", want: black},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("%s: status %d, want %d with that archive's page", tt.path, w.Code, http.StatusOK)
+		}
+	}
+
+	// a single archive is opened as usual
+	s, err := NewSessionServer(context.Background(), []string{first}, Options{TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.PageCount(); got != 2 {
+		t.Errorf("%d pages for one archive, want 2", got)
+	}
+}
@@ -0,0 +1,81 @@
+package cbzopen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a flag.Value for sizes like "512M" or "4GiB". Suffixes are
+// binary (K is 1024 bytes) with or without a trailing "iB" or "B".
+type ByteSize int64
+
+const (
+	KiB ByteSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+)
+
+func (s *ByteSize) String() string {
+	size := *s
+	for _, unit := range []struct {
+		size   ByteSize
+		suffix string
+	}{{TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}} {
+		if size >= unit.size && size%unit.size == 0 {
+			return fmt.Sprintf("%d%s", size/unit.size, unit.suffix)
+		}
+	}
+
+	return strconv.FormatInt(int64(size), 10)
+}
+
+func (s *ByteSize) Set(value string) error {
+	value = strings.TrimSpace(value)
+	upper := strings.ToUpper(value)
+
+	multiplier := ByteSize(1)
+	for _, unit := range []struct {
+		size   ByteSize
+		prefix string
+	}{{KiB, "K"}, {MiB, "M"}, {GiB, "G"}, {TiB, "T"}} {
+		for _, suffix := range []string{unit.prefix + "IB", unit.prefix + "B", unit.prefix} {
+			if strings.HasSuffix(upper, suffix) {
+				multiplier = unit.size
+				upper = strings.TrimSuffix(upper, suffix)
+				break
+			}
+		}
+		if multiplier != 1 {
+			break
+		}
+	}
+	if multiplier == 1 {
+		upper = strings.TrimSuffix(upper, "B")
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n < 0 {
+		return errors.New("invalid size, expected something like 512M or 4GiB")
+	}
+
+	*s = ByteSize(n) * multiplier
+	return nil
+}
+
+// Approx formats s rounded to one decimal in the largest unit that fits,
+// for showing to people rather than parsing back.
+func (s ByteSize) Approx() string {
+	for _, unit := range []struct {
+		size   ByteSize
+		suffix string
+	}{{TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}} {
+		if s >= unit.size {
+			return fmt.Sprintf("%.1f %s", float64(s)/float64(unit.size), unit.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%d B", s)
+}
@@ -0,0 +1,110 @@
+package cbzopen
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// sniffLen is how much of a file http.DetectContentType looks at.
+const sniffLen = 512
+
+// sniffImage reports the image type of name in fsys going by its content,
+// for pages whose extension is missing or wrong.
+func sniffImage(fsys fs.FS, name string) (string, bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer closeWithLog(f, "page")
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && n == 0 {
+		return "", false
+	}
+
+	return sniffHeader(header[:n])
+}
+
+// sniffHeader is sniffImage for the first sniffLen bytes of a file.
+func sniffHeader(header []byte) (string, bool) {
+	// AVIF is an ISO media file, which DetectContentType doesn't look into
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" && bytes.Equal(header[8:12], []byte("avif")) {
+		return "image/avif", true
+	}
+
+	mediaType := http.DetectContentType(header)
+	return mediaType, strings.HasPrefix(mediaType, "image/")
+}
+
+// isPage reports whether name in fsys is a page: an image with one of exts,
+// or a file without any extension that turns out to be an image.
+func isPage(fsys fs.FS, name string, exts []string) bool {
+	if isJunk(name) {
+		return false
+	}
+	if isImage(name, exts) {
+		return true
+	}
+	if path.Ext(name) != "" {
+		return false
+	}
+
+	_, ok := sniffImage(fsys, name)
+	return ok
+}
+
+// imagePagesFS is imagePages for names in fsys, also counting files without
+// an extension that are images, which some archives have. They're sorted
+// with order, see pageOrder.
+func imagePagesFS(fsys fs.FS, names []string, exts []string, order func(a, b string) int) []string {
+	var imageFiles []string
+	for _, name := range names {
+		if isPage(fsys, name, exts) {
+			imageFiles = append(imageFiles, name)
+		}
+	}
+
+	slices.SortFunc(imageFiles, order)
+
+	return imageFiles
+}
+
+// pageTypes sends pages with the Content-Type of what they actually are
+// rather than what their extension says. Each page is sniffed once.
+type pageTypes struct {
+	pages fs.FS
+	known map[string]bool
+	types sync.Map
+}
+
+func (p *pageTypes) sniff(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if !p.known[name] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		stored, ok := p.types.Load(name)
+		if !ok {
+			// an empty type leaves it to the extension
+			sniffed, found := sniffImage(p.pages, name)
+			if !found {
+				sniffed = ""
+			}
+			stored, _ = p.types.LoadOrStore(name, sniffed)
+		}
+		if mediaType := stored.(string); mediaType != "" {
+			w.Header().Set("Content-Type", mediaType)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
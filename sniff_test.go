@@ -0,0 +1,97 @@
+package cbzopen
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestSniffPages(t *testing.T) {
+	var page bytes.Buffer
+	if err := jpeg.Encode(&page, image.NewGray(image.Rect(0, 0, 2, 3)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		// wantType is the Content-Type it's served with, "" if it isn't a
+		// page
+		wantType string
+	}{
+		{name: "001", data: page.String(), wantType: "image/jpeg"},
+		{name: "002.png", data: page.String(), wantType: "image/jpeg"},
+		{name: "notes", data: "not a page"},
+		{name: "readme.txt", data: "not a page"},
+	}
+
+	var entries []testEntry
+	var wantPages []string
+	for _, tt := range tests {
+		entries = append(entries, testEntry{name: tt.name, data: tt.data})
+		if tt.wantType != "" {
+			wantPages = append(wantPages, tt.name)
+		}
+	}
+	archivePath := writeZip(t, entries)
+
+	// served in place and extracted
+	for _, opts := range []Options{{}, {Extract: true}} {
+		opts.TempDir = t.TempDir()
+		b, err := openBook(context.Background(), archivePath, opts.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		if !slices.Equal(b.imageFiles, wantPages) {
+			t.Errorf("%+v: pages %v, want %v", opts, b.imageFiles, wantPages)
+		}
+		for _, tt := range tests {
+			if tt.wantType == "" {
+				continue
+			}
+			w := httptest.NewRecorder()
+			b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.name, nil))
+			if got := w.Header().Get("Content-Type"); w.Code != http.StatusOK || got != tt.wantType {
+				t.Errorf("%+v: %s served with status %d as %q, want %q", opts, tt.name, w.Code, got, tt.wantType)
+			}
+		}
+	}
+}
+
+func TestExtraExtensions(t *testing.T) {
+	var page bytes.Buffer
+	if err := bmp.Encode(&page, image.NewGray(image.Rect(0, 0, 2, 3))); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := writeZip(t, []testEntry{{name: "1.bmp", data: page.String()}, {name: "2.jpg", data: page.String()}})
+
+	tests := []struct {
+		name string
+		exts []string
+		want []string
+	}{
+		{name: "defaults", want: []string{"2.jpg"}},
+		{name: "with .bmp", exts: []string{".bmp"}, want: []string{"1.bmp", "2.jpg"}},
+	}
+
+	for _, tt := range tests {
+		b, err := openBook(context.Background(), archivePath, Options{TempDir: t.TempDir(), ImageExtensions: tt.exts}.book())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		if !slices.Equal(b.imageFiles, tt.want) {
+			t.Errorf("%s: pages %q, want %q", tt.name, b.imageFiles, tt.want)
+		}
+	}
+}
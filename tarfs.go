@@ -0,0 +1,197 @@
+package cbzopen
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var gzipMagic = []byte("\x1f\x8b")
+
+// scanTar calls fn for each entry of the tar archive at archivePath, plain
+// or gzipped, until fn returns true or an error. r reads the entry's data.
+func scanTar(archivePath string, fn func(header *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(f, "archive")
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, err := r.(*bufio.Reader).Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer closeWithLog(gzipReader, "gzipReader")
+		r = gzipReader
+	}
+
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		stop, err := fn(header, tarReader)
+		if err != nil || stop {
+			return err
+		}
+	}
+}
+
+// tarEntryName returns the name of a tar entry as a valid fs.FS path, or
+// false for anything that isn't a regular file: folders, links and devices
+// are all skipped.
+func tarEntryName(header *tar.Header) (string, bool) {
+	if header.Typeflag != tar.TypeReg {
+		return "", false
+	}
+
+	name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+	return name, fs.ValidPath(name) && name != "."
+}
+
+func extractTar(archivePath, dir string, ex *extraction) error {
+	// tar is read as a stream, so count the files in a first pass
+	if ex.progress != nil {
+		err := scanTar(archivePath, func(header *tar.Header, _ io.Reader) (bool, error) {
+			if name, ok := tarEntryName(header); ok && !isJunk(name) {
+				ex.total++
+			}
+			return false, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read tar file: %w", err)
+		}
+	}
+
+	return scanTar(archivePath, func(header *tar.Header, r io.Reader) (bool, error) {
+		if err := ex.ctx.Err(); err != nil {
+			return false, err
+		}
+
+		name, ok := tarEntryName(header)
+		if !ok || isJunk(name) {
+			return false, nil
+		}
+
+		extractPath, err := ex.target(dir, name)
+		if err != nil {
+			return false, ex.skip(name, err)
+		}
+
+		if err := ex.writeFile(extractPath, header.FileInfo().Mode().Perm(), r); err != nil {
+			return false, ex.skip(name, fmt.Errorf("failed to extract tar file: %w", err))
+		}
+		ex.extracted()
+
+		return false, nil
+	})
+}
+
+// tarFS reads files out of a tar archive without extracting it. Tar can only
+// be read front to back, so each file opened means scanning the archive from
+// the start; that's fine for a cover and ComicInfo.xml.
+type tarFS struct {
+	path    string
+	modTime time.Time
+	files   map[string]bool
+	// dirs holds the sorted entries of each folder, "." for the top level
+	dirs map[string][]fs.DirEntry
+}
+
+func openTarFS(archivePath string) (*tarFS, error) {
+	t := &tarFS{path: archivePath, files: map[string]bool{}, dirs: map[string][]fs.DirEntry{".": nil}}
+
+	err := scanTar(archivePath, func(header *tar.Header, _ io.Reader) (bool, error) {
+		name, ok := tarEntryName(header)
+		if !ok || t.files[name] {
+			return false, nil
+		}
+		t.files[name] = true
+		t.add(name, fs.FileInfoToDirEntry(header.FileInfo()))
+		t.modTime = header.ModTime
+
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entries := range t.dirs {
+		slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	}
+
+	return t, nil
+}
+
+// add lists entry in the folder name is in, adding that folder to its own
+// parent if it's new.
+func (t *tarFS) add(name string, entry fs.DirEntry) {
+	dir := path.Dir(name)
+	if _, ok := t.dirs[dir]; !ok {
+		t.dirs[dir] = nil
+		t.add(dir, fs.FileInfoToDirEntry(memFileInfo{name: path.Base(dir), modTime: t.modTime, dir: true}))
+	}
+
+	t.dirs[dir] = append(t.dirs[dir], entry)
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if _, ok := t.dirs[name]; ok {
+		return &memDir{info: memFileInfo{name: path.Base(name), modTime: t.modTime, dir: true}}, nil
+	}
+	if !t.files[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var data []byte
+	var modTime time.Time
+	err := scanTar(t.path, func(header *tar.Header, r io.Reader) (bool, error) {
+		if entryName, ok := tarEntryName(header); !ok || entryName != name {
+			return false, nil
+		}
+
+		var err error
+		data, err = io.ReadAll(io.LimitReader(r, int64(maxPageSize)+1))
+		if err == nil && ByteSize(len(data)) > maxPageSize {
+			err = errors.New("file is too large")
+		}
+		modTime = header.ModTime
+
+		return true, err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return newMemFile(path.Base(name), data, modTime), nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return slices.Clone(entries), nil
+}
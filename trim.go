@@ -0,0 +1,150 @@
+package cbzopen
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultTrimThreshold is the default for Options.TrimThreshold.
+	DefaultTrimThreshold = 32
+
+	// trimNoise is the share of pixels in a row or column that may differ
+	// from the background while still counting as border, for specks of
+	// dust and scanner noise
+	trimNoise = 0.01
+	// trimMinKeep is the least of a page's width and height a trim may
+	// leave; cropping more than that is most likely a misdetection, e.g. a
+	// mostly white illustration
+	trimMinKeep = 0.5
+)
+
+// trimBounds returns the part of img left after cutting off the border rows
+// and columns, those nearly all within threshold of the top left pixel's
+// color on every channel (0-255).
+func trimBounds(img image.Image, threshold int) image.Rectangle {
+	bounds := img.Bounds()
+	bg := img.At(bounds.Min.X, bounds.Min.Y)
+	bgR, bgG, bgB, _ := bg.RGBA()
+	// RGBA returns 16-bit channels
+	limit := uint32(threshold) * 0x101
+
+	differs := func(x, y int) bool {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return absDiff(r, bgR) > limit || absDiff(g, bgG) > limit || absDiff(b, bgB) > limit
+	}
+
+	isBorder := func(x0, y0, dx, dy, n int) bool {
+		allowed := int(float64(n) * trimNoise)
+		count := 0
+		for i := range n {
+			if differs(x0+i*dx, y0+i*dy) {
+				count++
+				if count > allowed {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	trimmed := bounds
+	for trimmed.Min.Y < trimmed.Max.Y && isBorder(trimmed.Min.X, trimmed.Min.Y, 1, 0, trimmed.Dx()) {
+		trimmed.Min.Y++
+	}
+	for trimmed.Max.Y > trimmed.Min.Y && isBorder(trimmed.Min.X, trimmed.Max.Y-1, 1, 0, trimmed.Dx()) {
+		trimmed.Max.Y--
+	}
+	for trimmed.Min.X < trimmed.Max.X && isBorder(trimmed.Min.X, trimmed.Min.Y, 0, 1, trimmed.Dy()) {
+		trimmed.Min.X++
+	}
+	for trimmed.Max.X > trimmed.Min.X && isBorder(trimmed.Max.X-1, trimmed.Min.Y, 0, 1, trimmed.Dy()) {
+		trimmed.Max.X--
+	}
+
+	return trimmed
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// trimPage crops the border off the JPEG or PNG at path in place. Pages
+// with nothing to trim, or where trimming would take most of the page, are
+// left untouched.
+func trimPage(path string, threshold int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	img, format, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		// leave it for the browser, which may still be able to show it
+		return nil
+	}
+
+	bounds := img.Bounds()
+	trimmed := trimBounds(img, threshold)
+	if trimmed == bounds ||
+		float64(trimmed.Dx()) < float64(bounds.Dx())*trimMinKeep ||
+		float64(trimmed.Dy()) < float64(bounds.Dy())*trimMinKeep {
+		return nil
+	}
+
+	sub, ok := img.(subImager)
+	if !ok {
+		return nil
+	}
+	cropped := sub.SubImage(trimmed)
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, cropped, &jpeg.Options{Quality: 90})
+	case "png":
+		err = png.Encode(&buf, cropped)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// trimDir applies trimPage to every JPEG and PNG in dir and its subfolders.
+func trimDir(dir string, threshold int) error {
+	names, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+			continue
+		}
+
+		if err := trimPage(filepath.Join(dir, filepath.FromSlash(name)), threshold); err != nil {
+			return fmt.Errorf("failed to trim %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
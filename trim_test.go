@@ -0,0 +1,77 @@
+package cbzopen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// borderedPage returns a 100x80 PNG of border with a black box from
+// (10, 5) to (90, 75), and a white top left corner.
+func borderedPage(t *testing.T, border color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	draw.Draw(img, img.Bounds(), image.NewUniform(border), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 5, 90, 75), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	// a speck of dust in the margin, and a corner that's off by a little
+	// from the rest of it
+	img.Set(50, 2, color.Black)
+	img.Set(0, 0, color.White)
+
+	var page bytes.Buffer
+	if err := png.Encode(&page, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return page.Bytes()
+}
+
+func TestTrimPage(t *testing.T) {
+	offWhite := color.RGBA{R: 240, G: 235, B: 245, A: 255}
+	smallBox := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	draw.Draw(smallBox, smallBox.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(smallBox, image.Rect(40, 30, 60, 50), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var mostlyWhite bytes.Buffer
+	if err := png.Encode(&mostlyWhite, smallBox); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                  string
+		data                  []byte
+		threshold             int
+		wantWidth, wantHeight int
+	}{
+		{name: "white border", data: borderedPage(t, color.White), threshold: DefaultTrimThreshold, wantWidth: 80, wantHeight: 70},
+		{name: "off-white border", data: borderedPage(t, offWhite), threshold: DefaultTrimThreshold, wantWidth: 80, wantHeight: 70},
+		// with no tolerance, the corner doesn't match the rest of the border
+		{name: "off-white border, exact", data: borderedPage(t, offWhite), threshold: 0, wantWidth: 100, wantHeight: 80},
+		// cutting away more than half is more likely a mistake than a margin
+		{name: "mostly white", data: mostlyWhite.Bytes(), threshold: DefaultTrimThreshold, wantWidth: 100, wantHeight: 80},
+		{name: "nothing to trim", data: []byte(pngData(t, color.White)), threshold: DefaultTrimThreshold, wantWidth: 4, wantHeight: 4},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "page.png")
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := trimPage(path, tt.threshold); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width, height := imageSize(t, data); width != tt.wantWidth || height != tt.wantHeight {
+			t.Errorf("%s: trimmed to %dx%d, want %dx%d", tt.name, width, height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cbzopen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long a book has to stay unchanged before it's
+// reloaded, so one being written in several steps is only read once done.
+const watchDebounce = 500 * time.Millisecond
+
+// watch reopens the book at path whenever it changes, until Close. Files
+// are watched through their directory, since editors often save by
+// replacing the file rather than writing to it.
+func (s *Server) watch(ctx context.Context, path string, opts bookOptions) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+
+	dir := path
+	if !fileInfo.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	if err := watcher.Add(dir); err != nil {
+		closeWithLog(watcher, "watcher")
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	ctx, s.stopWatch = context.WithCancel(ctx)
+	s.watchDone = make(chan struct{})
+
+	go func() {
+		defer close(s.watchDone)
+		defer closeWithLog(watcher, "watcher")
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// in an image directory anything may be a page, for a file
+				// only a write or a replacement matters
+				changed := fileInfo.IsDir() ||
+					(event.Name == path && event.Has(fsnotify.Write|fsnotify.Create))
+				if changed {
+					debounce = time.After(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Failed to watch book", "file", path, "err", err)
+			case <-debounce:
+				debounce = nil
+				s.reload(ctx, path, opts)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload opens the book at path again and serves it in place of the current
+// one. If that fails, the current one stays.
+func (s *Server) reload(ctx context.Context, path string, opts bookOptions) {
+	slog.Info("Book changed, reloading", "file", path)
+
+	b, err := openBook(ctx, path, opts)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to reload book", "file", path, "err", err)
+		}
+		return
+	}
+	b.warmThumbnails()
+
+	s.mu.Lock()
+	old := s.content
+	s.content = newContent(b)
+	s.pageCount = len(b.imageFiles)
+	s.mu.Unlock()
+
+	slog.Info("Reloaded book", "file", path, "pageCount", len(b.imageFiles))
+	s.events.send("reload")
+
+	// requests that started on the old book still read from its files, so
+	// it's closed once they're done
+	old.Close()
+}
@@ -0,0 +1,225 @@
+package cbzopen
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+// zipFS serves the contents of a zip archive directly, without extracting it
+// to disk, along with a generated index.html.
+//
+// Files returned by zip.Reader.Open can't seek, which http.FileServerFS needs
+// for range requests, so zipFS opens regular entries itself. Stored entries
+// (the common case for cbz, since images are already compressed) are read
+// straight out of the archive file; compressed entries are inflated into
+// memory.
+type zipFS struct {
+	file   *os.File
+	reader *zip.Reader
+	files  map[string]*zip.File
+	index  []byte
+	opened time.Time
+
+	// imageFiles lists the pages in reading order
+	imageFiles []string
+}
+
+// openZipFS opens archivePath for serving, decoding non-UTF-8 entry names
+// with enc. Entries with one of exts are its pages.
+func openZipFS(archivePath string, enc encoding.Encoding, exts []string, order func(a, b string) int) (*zipFS, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		closeWithLog(f, "archive")
+		return nil, err
+	}
+
+	zipReader, err := zip.NewReader(f, fileInfo.Size())
+	if err != nil {
+		closeWithLog(f, "archive")
+		return nil, fmt.Errorf("failed to open zip file: %w", err)
+	}
+
+	z := &zipFS{
+		file:   f,
+		reader: zipReader,
+		files:  map[string]*zip.File{},
+		opened: time.Now(),
+	}
+
+	var names []string
+	for _, file := range zipReader.File {
+		// links would read as files holding their target, see extractZip
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		name := zipEntryName(file, enc)
+		z.files[name] = file
+		names = append(names, name)
+	}
+
+	z.imageFiles = imagePagesFS(z, names, exts, order)
+
+	return z, nil
+}
+
+// createIndexHTML generates the in-memory index.html served by z, putting
+// z.imageFiles in the order info gives first and leaving out the repeats
+// opts asks to.
+func (z *zipFS) createIndexHTML(info comicInfo, opts viewerOptions) error {
+	z.imageFiles = omitRepeats(z, orderPages(z.imageFiles, info), opts)
+
+	var index bytes.Buffer
+	if err := writeIndexHTML(&index, z, z.imageFiles, info, opts); err != nil {
+		return err
+	}
+	z.index = index.Bytes()
+
+	return nil
+}
+
+// Stat answers from the zip headers, without inflating the entry like Open
+// would.
+func (z *zipFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "index.html" {
+		return memFileInfo{name: name, size: int64(len(z.index)), modTime: z.opened}, nil
+	}
+	if file, ok := z.files[name]; ok {
+		return file.FileInfo(), nil
+	}
+
+	info, err := fs.Stat(z.reader, name)
+	if err == nil && !info.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return info, err
+}
+
+func (z *zipFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "index.html" {
+		return newMemFile(name, z.index, z.opened), nil
+	}
+
+	file, ok := z.files[name]
+	if !ok {
+		return z.openDir(name)
+	}
+
+	if file.Method == zip.Store {
+		offset, err := file.DataOffset()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		return &zipEntry{
+			ReadSeeker: io.NewSectionReader(z.file, offset, int64(file.UncompressedSize64)),
+			info:       file.FileInfo(),
+		}, nil
+	}
+
+	fileReader, err := file.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer closeWithLog(fileReader, "fileReader")
+
+	// don't let a compressed entry inflate past what we'd extract to disk
+	data, err := io.ReadAll(io.LimitReader(fileReader, int64(maxPageSize)+1))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if ByteSize(len(data)) > maxPageSize {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("file is too large")}
+	}
+
+	return &zipEntry{
+		ReadSeeker: bytes.NewReader(data),
+		info:       file.FileInfo(),
+	}, nil
+}
+
+// openDir opens the folder name with zip.Reader, which lists folders that
+// only show up in the file paths too. Anything else it knows of is an entry
+// openZipFS left out, like a link, and is reported as missing.
+func (z *zipFS) openDir(name string) (fs.File, error) {
+	f, err := z.reader.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := f.Stat(); err != nil || !info.IsDir() {
+		closeWithLog(f, "entry")
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f, nil
+}
+
+func (z *zipFS) Close() error {
+	return z.file.Close()
+}
+
+type zipEntry struct {
+	io.ReadSeeker
+	info fs.FileInfo
+}
+
+func (e *zipEntry) Stat() (fs.FileInfo, error) { return e.info, nil }
+func (e *zipEntry) Close() error               { return nil }
+
+type memFile struct {
+	*bytes.Reader
+	info memFileInfo
+}
+
+func newMemFile(name string, data []byte, modTime time.Time) *memFile {
+	return &memFile{
+		Reader: bytes.NewReader(data),
+		info:   memFileInfo{name: name, size: int64(len(data)), modTime: modTime},
+	}
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() any           { return nil }
+
+func (i memFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
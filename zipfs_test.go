@@ -0,0 +1,83 @@
+package cbzopen
+
+import (
+	"archive/zip"
+	"context"
+	"image/color"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZipServedInPlace(t *testing.T) {
+	page := pngData(t, color.White)
+
+	// one page stored, the way most cbz files hold them, and one deflated
+	archivePath := filepath.Join(t.TempDir(), "book.cbz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, method := range map[string]uint16{"stored.png": zip.Store, "deflated.png": zip.Deflate} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(page)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closeWithLog(f, "test zip")
+
+	tempDir := t.TempDir()
+	b, err := openBook(context.Background(), archivePath, Options{TempDir: tempDir}.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, ok := b.pages.(*zipFS); !ok {
+		t.Fatalf("pages are a %T, want a *zipFS", b.pages)
+	}
+	err = filepath.WalkDir(tempDir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			t.Errorf("%s written to disk", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		rangeHdr string
+		want     int
+		wantBody string
+	}{
+		{name: "stored.png", want: http.StatusOK, wantBody: page},
+		{name: "deflated.png", want: http.StatusOK, wantBody: page},
+		// seeking works either way, for range requests
+		{name: "stored.png", rangeHdr: "bytes=1-3", want: http.StatusPartialContent, wantBody: page[1:4]},
+		{name: "deflated.png", rangeHdr: "bytes=1-3", want: http.StatusPartialContent, wantBody: page[1:4]},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/"+tt.name, nil)
+		if tt.rangeHdr != "" {
+			r.Header.Set("Range", tt.rangeHdr)
+		}
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, r)
+		if w.Code != tt.want || w.Body.String() != tt.wantBody {
+			t.Errorf("%s %s: status %d with %d bytes, want %d with %d", tt.name, tt.rangeHdr, w.Code, w.Body.Len(), tt.want, len(tt.wantBody))
+		}
+	}
+}